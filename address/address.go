@@ -25,11 +25,17 @@ func NewAddress() *Address {
 	return &addr
 }
 
-// GetAddress returns Address address
-func (w Address) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
+// GetAddress returns Address address with the given version byte
+func (w Address) GetAddress(version byte) []byte {
+	return PubKeyToAddress(w.PublicKey, version)
+}
+
+// PubKeyToAddress returns the address of the given
+// public key with the given version byte
+func PubKeyToAddress(pubKey []byte, version byte) []byte {
+	pubKeyHash := HashPubKey(pubKey)
 
-	versionedPayload := append([]byte{Version}, pubKeyHash...)
+	versionedPayload := append([]byte{version}, pubKeyHash...)
 	checksum := checksum(versionedPayload)
 
 	fullPayload := append(versionedPayload, checksum...)
@@ -52,11 +58,17 @@ func HashPubKey(pubKey []byte) []byte {
 	return publicRIPEMD160
 }
 
-// ValidateAddress check if address if valid
-func ValidateAddress(address string) bool {
+// ValidateAddress check if address if valid and has the given version byte
+func ValidateAddress(address string, version byte) bool {
 	pubKeyHash := Base58Decode([]byte(address))
+	if len(pubKeyHash) <= AddressChecksumLen {
+		return false
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-AddressChecksumLen:]
 	ver := pubKeyHash[0]
+	if ver != version {
+		return false
+	}
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-AddressChecksumLen]
 	targetChecksum := checksum(append([]byte{ver}, pubKeyHash...))
 
@@ -77,7 +89,12 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	if err != nil {
 		log.Panic(err)
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	// Both coordinates are padded to the curve size so the
+	// key can be split in the middle when verifying signatures
+	pubKey := make([]byte, 64)
+	x, y := private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()
+	copy(pubKey[32-len(x):32], x)
+	copy(pubKey[64-len(y):], y)
 
 	return *private, pubKey
 }
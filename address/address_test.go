@@ -0,0 +1,30 @@
+package address
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBase58LeadingZeroes checks leading zero bytes
+// survive a round trip through base58
+func TestBase58LeadingZeroes(t *testing.T) {
+	input := []byte{0x00, 0x00, 0x01, 0x02}
+
+	encoded := Base58Encode(input)
+	assert.Equal(t, "115T", string(encoded))
+	assert.Equal(t, input, Base58Decode(encoded))
+}
+
+// TestValidateAddress checks an address is only
+// valid with the version it was encoded with
+func TestValidateAddress(t *testing.T) {
+	addr := NewAddress()
+
+	for _, version := range []byte{0x00, 0x6f, 0x7a} {
+		encoded := string(addr.GetAddress(version))
+
+		assert.True(t, ValidateAddress(encoded, version), "Address is valid with its version")
+		assert.False(t, ValidateAddress(encoded, version+1), "Address is invalid with another version")
+	}
+}
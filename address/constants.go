@@ -1,6 +1,5 @@
 package address
 
 const (
-	Version            = byte(0x00)
 	AddressChecksumLen = 4
 )
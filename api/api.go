@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	log "github.com/murlokito/gophercoin/log"
 	"net/http"
 	"sync"
@@ -14,10 +15,11 @@ import (
 // This is defined in order for it to be easily created with a structure
 // that defines the API Routes
 type APIServer struct {
-	config Config
-	router *mux.Router
-	logger log.Logger
-	wg     *sync.WaitGroup
+	config     Config
+	router     *mux.Router
+	logger     log.Logger
+	wg         *sync.WaitGroup
+	httpServer *http.Server
 }
 
 // Route is a structure that defines the endpoints of the API.
@@ -70,35 +72,45 @@ func LogMiddleware(logger log.Logger, inner http.Handler, name string) http.Hand
 }
 
 // BuildAndServeAPI is the function used to serve the API endpoints
-func (s APIServer) BuildAndServeAPI() {
+// until it is stopped
+func (s *APIServer) BuildAndServeAPI() {
+	defer s.wg.Done()
+
 	s.logger.Info("Building API endpoints.")
 
 	s.router = NewRouter(s.logger, s.config.Routes)
+	s.httpServer.Handler = handlers.CORS(
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
+		handlers.AllowedMethods([]string{"GET", "POST"}),
+		handlers.AllowedOrigins([]string{"*"}),
+	)(s.router)
 
 	s.logger.Info("Listening and Serving API. Port: %s", s.config.Port)
 
-	err := http.ListenAndServe(":"+s.config.Port,
-		handlers.CORS(
-			handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
-			handlers.AllowedMethods([]string{"GET", "POST"}),
-			handlers.AllowedOrigins([]string{"*"}),
-		)(s.router),
-	)
+	err := s.httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		s.logger.WithError(err).Error("API server failed")
+	}
+}
 
-	s.logger.WithError(err)
+// Stop stops the API server, waiting for the requests
+// being handled until the context is done
+func (s *APIServer) Stop(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
 
 // NewAPIServer creates and runs a new API Server
 func NewAPIServer(wg *sync.WaitGroup, config Config) *APIServer {
 	server := &APIServer{
-		config: config,
-		router: nil,
-		logger: log.NewLogger(config.LogLevel),
-		wg:     wg,
+		config:     config,
+		router:     nil,
+		logger:     log.NewLogger(config.LogLevel),
+		wg:         wg,
+		httpServer: &http.Server{Addr: ":" + config.Port},
 	}
 
-	go server.BuildAndServeAPI()
 	wg.Add(1)
+	go server.BuildAndServeAPI()
 
 	return server
 }
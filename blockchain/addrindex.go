@@ -0,0 +1,245 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// The address index is optional, when its bucket exists it is kept up to
+// date as blocks are connected and disconnected. It holds an entry for
+// every main chain transaction which pays to or spends from a public key
+// hash, keyed by the hash followed by the height of the block and the
+// position of the transaction in it so the history of an address is a
+// contiguous, ordered range of keys.
+
+// AddressTx is a transaction of the history of an address
+type AddressTx struct {
+	BlockHash []byte
+	Height    int
+	Tx        *transaction.Transaction
+}
+
+// addrIndexPrefix returns the prefix shared by all the
+// entries of the given public key hash
+func addrIndexPrefix(pubKeyHash []byte) []byte {
+	return append([]byte{byte(len(pubKeyHash))}, pubKeyHash...)
+}
+
+// addrIndexKey returns the key of the entry of the given public key
+// hash for the transaction at position pos of the block at height
+func addrIndexKey(pubKeyHash []byte, height, pos int) []byte {
+	key := addrIndexPrefix(pubKeyHash)
+
+	var location [8]byte
+	binary.BigEndian.PutUint32(location[:4], uint32(height))
+	binary.BigEndian.PutUint32(location[4:], uint32(pos))
+
+	return append(key, location[:]...)
+}
+
+// txPubKeyHashes returns the public key hashes the transaction pays
+// to or spends from, each only once
+func txPubKeyHashes(tx *transaction.Transaction) [][]byte {
+	var hashes [][]byte
+	seen := make(map[string]bool)
+
+	add := func(pubKeyHash []byte) {
+		if len(pubKeyHash) == 0 || len(pubKeyHash) > 255 || seen[string(pubKeyHash)] {
+			return
+		}
+		seen[string(pubKeyHash)] = true
+		hashes = append(hashes, pubKeyHash)
+	}
+
+	if !tx.IsCoinbase() {
+		for _, vin := range tx.Vin {
+			add(address.HashPubKey(vin.PubKey))
+		}
+	}
+
+	for _, out := range tx.Vout {
+		add(out.PubKeyHash)
+	}
+
+	return hashes
+}
+
+// indexBlockAddresses adds the transactions of the block to the
+// address index, when there is one
+func indexBlockAddresses(tx database.Tx, block *Block) error {
+	b := tx.Bucket([]byte(addrIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for pos, t := range block.Transactions {
+		for _, pubKeyHash := range txPubKeyHashes(t) {
+			err := b.Put(addrIndexKey(pubKeyHash, block.Height, pos), block.Hash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unindexBlockAddresses removes the transactions of the block
+// from the address index, when there is one
+func unindexBlockAddresses(tx database.Tx, block *Block) error {
+	b := tx.Bucket([]byte(addrIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for pos, t := range block.Transactions {
+		for _, pubKeyHash := range txPubKeyHashes(t) {
+			err := b.Delete(addrIndexKey(pubKeyHash, block.Height, pos))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// HasAddrIndex returns whether the address index is maintained
+func (bc *Blockchain) HasAddrIndex() bool {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var exists bool
+
+	err := bc.db.View(func(tx database.Tx) error {
+		exists = tx.Bucket([]byte(addrIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+
+	return exists
+}
+
+// BuildAddrIndex builds the address index from the main chain,
+// replacing the existing one if any. From then on the index is kept
+// up to date as blocks are connected and disconnected.
+func (bc *Blockchain) BuildAddrIndex() error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.db.Update(func(tx database.Tx) error {
+		if tx.Bucket([]byte(addrIndexBucket)) != nil {
+			err := tx.DeleteBucket([]byte(addrIndexBucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.CreateBucket([]byte(addrIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		heights := tx.Bucket([]byte(heightBucket))
+		if heights == nil {
+			return nil
+		}
+
+		c := heights.Cursor()
+		for k, hash := c.First(); k != nil; k, hash = c.Next() {
+			block, err := fetchBlock(blocks, hash)
+			if err != nil {
+				return err
+			}
+
+			err = indexBlockAddresses(tx, block)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DropAddrIndex removes the address index
+func (bc *Blockchain) DropAddrIndex() error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.db.Update(func(tx database.Tx) error {
+		if tx.Bucket([]byte(addrIndexBucket)) == nil {
+			return nil
+		}
+
+		return tx.DeleteBucket([]byte(addrIndexBucket))
+	})
+}
+
+// AddressHistory returns a page of the transactions which paid to or
+// spent from the given public key hash, newest first, skipping the
+// first skip ones and returning at most count. The total number of
+// transactions in the history is returned along with the page.
+func (bc *Blockchain) AddressHistory(pubKeyHash []byte, skip, count int) ([]AddressTx, int, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var history []AddressTx
+	var total int
+
+	if skip < 0 || count < 0 {
+		return nil, 0, errors.New("skip and count must not be negative")
+	}
+
+	err := bc.db.View(func(tx database.Tx) error {
+		b := tx.Bucket([]byte(addrIndexBucket))
+		if b == nil {
+			return errors.New("address index is not enabled")
+		}
+
+		// The keys are only a few bytes long, collect them all to
+		// know the total and walk the page from the newest one
+		var keys, hashes [][]byte
+		prefix := addrIndexPrefix(pubKeyHash)
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+			hashes = append(hashes, append([]byte{}, v...))
+		}
+		total = len(keys)
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		for i := total - 1 - skip; i >= 0 && len(history) < count; i-- {
+			location := keys[i][len(prefix):]
+			height := int(binary.BigEndian.Uint32(location[:4]))
+			pos := int(binary.BigEndian.Uint32(location[4:]))
+
+			block, err := fetchBlock(blocks, hashes[i])
+			if err != nil {
+				return err
+			}
+			if pos >= len(block.Transactions) {
+				return errors.New("corrupt address index entry")
+			}
+
+			history = append(history, AddressTx{
+				BlockHash: block.Hash,
+				Height:    height,
+				Tx:        block.Transactions[pos],
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return history, total, nil
+}
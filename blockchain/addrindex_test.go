@@ -0,0 +1,109 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAddrIndex checks the address index built from the main chain
+// pages through the history of an address and follows the blocks
+// connected and disconnected afterwards
+func TestAddrIndex(t *testing.T) {
+	a := address.NewAddress()
+	b := address.NewAddress()
+	bc, params, main := reorgChain(t, a)
+	pubKeyHashA := address.HashPubKey(a.PublicKey)
+	pubKeyHashB := address.HashPubKey(b.PublicKey)
+	addrB := string(b.GetAddress(params.AddressVersion))
+
+	_, _, err := bc.AddressHistory(pubKeyHashA, 0, 10)
+	assert.Error(t, err, "History needs the index")
+
+	assert.False(t, bc.HasAddrIndex())
+	assert.NoError(t, bc.BuildAddrIndex())
+	assert.True(t, bc.HasAddrIndex())
+
+	// The coinbase of a1, then the coinbase and the spend of a2
+	history := []AddressTx{
+		{BlockHash: main[1].Hash, Height: 2, Tx: main[1].Transactions[1]},
+		{BlockHash: main[1].Hash, Height: 2, Tx: main[1].Transactions[0]},
+		{BlockHash: main[0].Hash, Height: 1, Tx: main[0].Transactions[0]},
+	}
+	pages := []struct {
+		skip, count int
+		want        []AddressTx
+	}{
+		{0, 10, history},
+		{0, 3, history},
+		{0, 2, history[:2]},
+		{1, 1, history[1:2]},
+		{2, 10, history[2:]},
+		{3, 10, nil},
+		{10, 10, nil},
+		{0, 0, nil},
+	}
+	for _, page := range pages {
+		got, total, err := bc.AddressHistory(pubKeyHashA, page.skip, page.count)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, total)
+		if assert.Len(t, got, len(page.want), "skip %d count %d", page.skip, page.count) {
+			for i := range got {
+				assert.Equal(t, page.want[i].BlockHash, got[i].BlockHash)
+				assert.Equal(t, page.want[i].Height, got[i].Height)
+				assert.Equal(t, page.want[i].Tx.ID, got[i].Tx.ID)
+			}
+		}
+	}
+
+	_, _, err = bc.AddressHistory(pubKeyHashA, -1, 10)
+	assert.Error(t, err)
+	_, _, err = bc.AddressHistory(pubKeyHashA, 0, -1)
+	assert.Error(t, err)
+
+	got, total, err := bc.AddressHistory(pubKeyHashB, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Equal(t, 0, total)
+
+	// Blocks connected once the index is built are indexed
+	a3, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addrB, "", CalcBlockSubsidy(3, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, total, err = bc.AddressHistory(pubKeyHashB, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, a3.Transactions[0].ID, got[0].Tx.ID)
+	}
+
+	// A reorganization removes the entries of the disconnected blocks
+	side := sideBranch(params, addrB, 4, func(height int) int {
+		return CalcBlockSubsidy(height, params)
+	})
+	for _, block := range side {
+		assert.NoError(t, bc.AddBlock(block))
+	}
+	assert.Equal(t, side[3].Hash, bc.Tip)
+
+	got, total, err = bc.AddressHistory(pubKeyHashA, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Equal(t, 0, total)
+
+	got, total, err = bc.AddressHistory(pubKeyHashB, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, total)
+	if assert.Len(t, got, 4) {
+		for i, block := range side {
+			assert.Equal(t, block.Transactions[0].ID, got[3-i].Tx.ID)
+			assert.Equal(t, block.Height, got[3-i].Height)
+		}
+	}
+
+	assert.NoError(t, bc.DropAddrIndex())
+	assert.False(t, bc.HasAddrIndex())
+}
@@ -2,36 +2,231 @@ package blockchain
 
 import (
 	"bytes"
-	"encoding/gob"
-	"github.com/murlokito/gophercoin/transaction"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"log"
-	"time"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/murlokito/gophercoin/wire"
 )
 
+// BlockHeader holds the fields of a block which are hashed
+// to produce the block hash. The transactions are committed
+// to through the merkle root, so the proof of work of a
+// header can be checked without them.
+type BlockHeader struct {
+	Version       int32
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	Bits          uint32
+	Nonce         uint32
+}
+
+// Encode writes the header in its fixed size binary form:
+// version, previous block hash, merkle root, timestamp, bits
+// and nonce, with integers in little endian and hashes taking
+// 32 bytes, all zeroes when empty.
+func (h *BlockHeader) Encode(w io.Writer) error {
+	err := wire.WriteUint32(w, uint32(h.Version))
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteHash(w, h.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteHash(w, h.MerkleRoot)
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteUint64(w, uint64(h.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteUint32(w, h.Bits)
+	if err != nil {
+		return err
+	}
+
+	return wire.WriteUint32(w, h.Nonce)
+}
+
+// Decode reads a header written by Encode from r
+func (h *BlockHeader) Decode(r io.Reader) error {
+	version, err := wire.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	h.Version = int32(version)
+
+	h.PrevBlockHash, err = wire.ReadHash(r)
+	if err != nil {
+		return err
+	}
+
+	h.MerkleRoot, err = wire.ReadHash(r)
+	if err != nil {
+		return err
+	}
+
+	timestamp, err := wire.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	h.Timestamp = int64(timestamp)
+
+	h.Bits, err = wire.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+
+	h.Nonce, err = wire.ReadUint32(r)
+	return err
+}
+
+// Serialize returns the encoding of the header
+func (h *BlockHeader) Serialize() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, blockHeaderLen))
+
+	err := h.Encode(buf)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// Hash returns the hash of the header, which is the block hash
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+	return hash[:]
+}
+
 // Block is the unit structure of
 // a blockchain. It will store information
 // which will be hashed, the hash of the
 // previous block and the time of its creation
 type Block struct {
-	Timestamp     int64
-	PrevBlockHash []byte
-	Transactions  []*transaction.Transaction
-	Hash          []byte
-	Nonce         int
-	Height        int
+	BlockHeader
+	Transactions []*transaction.Transaction
+	Hash         []byte
+	Height       int
 }
 
-// HashTransactions returns a hash of the transactions in the block
-func (b *Block) HashTransactions() []byte {
+// merkleTree returns the Merkle tree of the IDs of the
+// transactions in the block
+func (b *Block) merkleTree() *MerkleTree {
 	var txHashes [][]byte
 
 	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.Serialize())
+		txHashes = append(txHashes, tx.ID)
+	}
+
+	return NewMerkleTree(txHashes)
+}
+
+// HashTransactions returns a hash of the transactions in the block,
+// the root of the Merkle tree of their IDs
+func (b *Block) HashTransactions() []byte {
+	return b.merkleTree().RootNode.Data
+}
+
+// TxMerkleProof returns the proof that the transaction with
+// the given ID is committed to by the block's merkle root
+func (b *Block) TxMerkleProof(txID []byte) (*MerkleProof, error) {
+	for i, tx := range b.Transactions {
+		if bytes.Equal(tx.ID, txID) {
+			return b.merkleTree().Proof(i)
+		}
+	}
+
+	return nil, fmt.Errorf("transaction %x is not in block %x", txID, b.Hash)
+}
+
+// Encode writes the block to w: its header, its height
+// and its transactions prefixed by their count.
+// The hash is not written as it is the hash of the header.
+func (b *Block) Encode(w io.Writer) error {
+	err := b.BlockHeader.Encode(w)
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteUint32(w, uint32(b.Height))
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteVarInt(w, uint64(len(b.Transactions)))
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range b.Transactions {
+		err = tx.Encode(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads a block written by Encode from r
+// and sets its hash from the header
+func (b *Block) Decode(r io.Reader) error {
+	err := b.BlockHeader.Decode(r)
+	if err != nil {
+		return err
 	}
 
-	mTree := NewMerkleTree(txHashes)
+	height, err := wire.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	b.Height = int(height)
+
+	count, err := wire.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
 
-	return mTree.RootNode.Data
+	if count > maxBlockTransactions {
+		return fmt.Errorf("too many transactions [count %d, max %d]", count, maxBlockTransactions)
+	}
+
+	b.Transactions = make([]*transaction.Transaction, count)
+	for i := range b.Transactions {
+		tx := &transaction.Transaction{}
+		err = tx.Decode(r)
+		if err != nil {
+			return err
+		}
+		b.Transactions[i] = tx
+	}
+
+	b.Hash = b.BlockHeader.Hash()
+
+	return nil
+}
+
+// SerializeSize returns the size in bytes of the block written by Encode
+func (b *Block) SerializeSize() int {
+	// The header and the height, followed by the transactions
+	size := blockHeaderLen + 4 + wire.VarIntSerializeSize(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		size += len(tx.Serialize())
+	}
+
+	return size
 }
 
 // DeserializeBlock is used to decode the Block before
@@ -39,8 +234,7 @@ func (b *Block) HashTransactions() []byte {
 func DeserializeBlock(d []byte) (*Block, error) {
 	var block Block
 
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
+	err := block.Decode(bytes.NewReader(d))
 	if err != nil {
 		log.Printf("Error deserializing block")
 		return nil, err
@@ -52,9 +246,8 @@ func DeserializeBlock(d []byte) (*Block, error) {
 // insertion in BoltDB
 func (b *Block) SerializeBlock() ([]byte, error) {
 	var result bytes.Buffer
-	encoder := gob.NewEncoder(&result)
 
-	err := encoder.Encode(b)
+	err := b.Encode(&result)
 	if err != nil {
 		log.Printf("Error serializing block")
 		return nil, err
@@ -63,28 +256,67 @@ func (b *Block) SerializeBlock() ([]byte, error) {
 	return result.Bytes(), nil
 }
 
-// NewBlock is the func to create a new block
-func NewBlock(prevBlockHash []byte, transactions []*transaction.Transaction, height int) *Block {
+// newBlockTemplate creates a block which is not mined yet,
+// with the merkle root of the transactions committed to
+// in its header
+func newBlockTemplate(prevBlockHash []byte, transactions []*transaction.Transaction, height int, bits uint32, timestamp int64) *Block {
+	b := &Block{
+		BlockHeader: BlockHeader{
+			Version:       blockVersion,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     timestamp,
+			Bits:          bits,
+			Nonce:         0,
+		},
+		Transactions: transactions,
+		Hash:         []byte{},
+		Height:       height,
+	}
+	b.MerkleRoot = b.HashTransactions()
+
+	return b
+}
+
+// NewBlock is the func to create a new block with the
+// given timestamp, mined at the difficulty given by bits
+// on a single worker
+func NewBlock(prevBlockHash []byte, transactions []*transaction.Transaction, height int, bits uint32, timestamp int64) *Block {
 
 	//Initialize the block structure with the given data
-	b := &Block{
-		Timestamp:     time.Now().Unix(),
-		PrevBlockHash: prevBlockHash,
-		Transactions:  transactions,
-		Hash:          []byte{},
-		Nonce:         0,
-		Height:        height,
-	}
-	pow := NewProofOfWork(b)
-	nonce, hash := pow.run()
-	b.Hash = hash[:]
-	b.Nonce = nonce
+	b := newBlockTemplate(prevBlockHash, transactions, height, bits, timestamp)
+
+	// Without a deadline the search only ends once the block is solved
+	b.Solve(context.Background(), 1, nil)
 
 	return b
 }
 
-//	func that creates the Blockchain with
-//	the Genesis Block as its first block
-func genesisBlock(coinbasetx *transaction.Transaction) *Block {
-	return NewBlock([]byte{}, []*transaction.Transaction{coinbasetx}, 0)
+// genesisBlock builds the genesis block of the given network,
+// the first block of the chain, from its genesis parameters
+func genesisBlock(params *chaincfg.Params) *Block {
+	coinbase := &transaction.Transaction{
+		Vin: []transaction.TXInput{{
+			Txid:   []byte{},
+			Vout:   -1,
+			PubKey: []byte(params.GenesisCoinbaseData),
+		}},
+		Vout: []transaction.TXOutput{{
+			Value:      params.BaseSubsidy,
+			PubKeyHash: params.GenesisPubKeyHash,
+		}},
+	}
+	coinbase.ID = coinbase.Hash()
+
+	b := newBlockTemplate([]byte{}, []*transaction.Transaction{coinbase}, 0, params.PowLimitBits, params.GenesisTimestamp)
+
+	// A single worker finds the lowest nonce, so the
+	// genesis block is the same on every node
+	nonce, hash, _, err := NewProofOfWork(&b.BlockHeader).solve(context.Background(), 1)
+	if err != nil {
+		panic(err)
+	}
+	b.Hash = hash
+	b.Nonce = nonce
+
+	return b
 }
@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBlockEncoding checks a block against its known encoding
+// and hash, and that decoding it gives back the same block
+func TestBlockEncoding(t *testing.T) {
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("gophercoin")}},
+		Vout: []transaction.TXOutput{{Value: 10, PubKeyHash: []byte{0x01, 0x02, 0x03, 0x04}}},
+	}
+	tx.ID = tx.Hash()
+
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       1,
+			PrevBlockHash: []byte{},
+			MerkleRoot:    tx.ID,
+			Timestamp:     1557266400,
+			Bits:          0x1f7fffff,
+			Nonce:         42,
+		},
+		Transactions: []*transaction.Transaction{tx},
+		Height:       0,
+	}
+	block.Hash = block.BlockHeader.Hash()
+
+	header := "01000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000" +
+		"703fe3cc08f9edc39f765ae86371b22485cdfddb5bcdfd71479bb7477d6358e5" +
+		"e0ffd15c00000000" + "ffff7f1f" + "2a000000"
+	assert.Equal(t, header, hex.EncodeToString(block.BlockHeader.Serialize()))
+	assert.Equal(t, blockHeaderLen, len(block.BlockHeader.Serialize()))
+	assert.Equal(t, "37d1955ecbb6bfa8cbc29992c5dac2511d56dd3a5e22fbab19a0e1e103d365a0", hex.EncodeToString(block.Hash))
+
+	encoded, err := block.SerializeBlock()
+	assert.NoError(t, err)
+	assert.Equal(t, header+"00000000"+"01"+hex.EncodeToString(tx.Serialize()), hex.EncodeToString(encoded))
+
+	decoded, err := DeserializeBlock(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, block.Hash, decoded.Hash)
+	assert.Equal(t, block.Height, decoded.Height)
+	assert.Empty(t, decoded.PrevBlockHash)
+	assert.Equal(t, tx.ID, decoded.Transactions[0].ID)
+}
+
+// TestGenesisBlocks checks the genesis block built for each network
+// matches the hash in its parameters and passes the block checks
+func TestGenesisBlocks(t *testing.T) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNetParams, &chaincfg.RegressionNetParams} {
+		genesis := genesisBlock(params)
+
+		assert.Equal(t, params.GenesisHash, genesis.Hash, params.Name)
+		assert.NoError(t, CheckBlock(genesis, params, NewMedianTime(SystemClock), BFNone), params.Name)
+	}
+}
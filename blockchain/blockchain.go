@@ -2,15 +2,18 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/murlokito/gophercoin/transaction"
 	"log"
+	"math/big"
 	"os"
 	"sync"
 
-	"github.com/boltdb/bolt"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
 )
 
 const (
@@ -21,9 +24,56 @@ const (
 // Arrays in Go are ordered by default,
 // which helps with some minor issues
 type Blockchain struct {
-	Tip   []byte
-	db    *bolt.DB
-	mutex *sync.RWMutex
+	Tip        []byte
+	db         database.DB
+	params     *chaincfg.Params
+	timeSource MedianTimeSource
+	mutex      *sync.RWMutex
+
+	notifications      []NotificationCallback
+	notificationsMutex *sync.RWMutex
+
+	orphans     map[string]*orphanBlock
+	prevOrphans map[string][]*orphanBlock
+	orphanMutex *sync.Mutex
+
+	// assumeValid is guarded by orphanMutex, as it
+	// walks through the orphans
+	assumeValid assumeValidAncestry
+}
+
+// newBlockchain initializes a Blockchain of the given
+// network backed by the given db
+func newBlockchain(db database.DB, params *chaincfg.Params, tip []byte) *Blockchain {
+	return &Blockchain{
+		Tip:                tip,
+		db:                 db,
+		params:             params,
+		timeSource:         NewMedianTime(SystemClock),
+		mutex:              &sync.RWMutex{},
+		notificationsMutex: &sync.RWMutex{},
+		orphans:            make(map[string]*orphanBlock),
+		prevOrphans:        make(map[string][]*orphanBlock),
+		orphanMutex:        &sync.Mutex{},
+	}
+}
+
+// SetTimeSource replaces the source of the network-adjusted time
+// the timestamps of new blocks are checked against and stamped with
+func (bc *Blockchain) SetTimeSource(timeSource MedianTimeSource) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.timeSource = timeSource
+}
+
+// Close closes the database of the chain, which
+// must not be used afterwards
+func (bc *Blockchain) Close() error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.db.Close()
 }
 
 // fileExists is used to check if the database
@@ -42,7 +92,7 @@ func (bc *Blockchain) GetBestHeight() int {
 	defer bc.mutex.RUnlock()
 	var block *Block
 
-	err := bc.db.View(func(tx *bolt.Tx) error {
+	err := bc.db.View(func(tx database.Tx) error {
 		var err error
 		b := tx.Bucket([]byte(blocksBucket))
 		lastHash := b.Get([]byte("l"))
@@ -68,7 +118,7 @@ func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	defer bc.mutex.RUnlock()
 	var block *Block
 
-	err := bc.db.View(func(tx *bolt.Tx) error {
+	err := bc.db.View(func(tx database.Tx) error {
 		var err error
 		b := tx.Bucket([]byte(blocksBucket))
 
@@ -86,12 +136,86 @@ func (bc *Blockchain) GetBlock(blockHash []byte) (Block, error) {
 	})
 
 	if err != nil {
-		return *block, err
+		return Block{}, err
+	}
+
+	return *block, nil
+}
+
+// GetBlockHashByHeight returns the hash of the main chain block at the given height
+func (bc *Blockchain) GetBlockHashByHeight(height int) ([]byte, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var hash []byte
+
+	err := bc.db.View(func(tx database.Tx) error {
+		var err error
+		hash, err = fetchHashByHeight(tx, height)
+		return err
+	})
+
+	return hash, err
+}
+
+// GetBlockByHeight returns the main chain block at the given height
+func (bc *Blockchain) GetBlockByHeight(height int) (Block, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var block *Block
+
+	err := bc.db.View(func(tx database.Tx) error {
+		hash, err := fetchHashByHeight(tx, height)
+		if err != nil {
+			return err
+		}
+
+		block, err = fetchBlock(tx.Bucket([]byte(blocksBucket)), hash)
+		return err
+	})
+	if err != nil {
+		return Block{}, err
 	}
 
 	return *block, nil
 }
 
+// GetBlockHeader returns the header of the block with the given hash
+func (bc *Blockchain) GetBlockHeader(blockHash []byte) (*BlockHeader, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var header *BlockHeader
+
+	err := bc.db.View(func(tx database.Tx) error {
+		block, err := fetchBlock(tx.Bucket([]byte(blocksBucket)), blockHash)
+		if err != nil {
+			return err
+		}
+
+		header = &block.BlockHeader
+		return nil
+	})
+
+	return header, err
+}
+
+// HaveBlock returns whether the block with the given hash is stored,
+// either in the main chain or in a side branch
+func (bc *Blockchain) HaveBlock(blockHash []byte) bool {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var exists bool
+
+	err := bc.db.View(func(tx database.Tx) error {
+		exists = tx.Bucket([]byte(blocksBucket)).Get(blockHash) != nil
+		return nil
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return exists
+}
+
 // GetBlockHashes returns a list of hashes of all the blocks in the chain
 func (bc *Blockchain) GetBlockHashes() [][]byte {
 	bc.mutex.RLock()
@@ -115,130 +239,359 @@ func (bc *Blockchain) GetBlockHashes() [][]byte {
 // MineBlock is the method used to mine a block
 // with the provided transactions. The parameter `transactions`
 // passed as a pointer to a slice of transactions
-func (bc *Blockchain) MineBlock(transactions []*transaction.Transaction) *Block {
-	bc.mutex.Lock()
-	defer bc.mutex.Unlock()
+func (bc *Blockchain) MineBlock(transactions []*transaction.Transaction) (*Block, error) {
+	block, _, err := bc.MineBlockContext(context.Background(), transactions, 1)
+	return block, err
+}
+
+// MineBlockContext mines a block on top of the tip with the provided
+// transactions, searching for its nonce with the given number of
+// workers, and adds it to the chain. The search is abandoned with the
+// error of the context once it is done, when a new tip makes the block
+// stale for instance. The work done is reported along with the block.
+func (bc *Blockchain) MineBlockContext(ctx context.Context, transactions []*transaction.Transaction, workers int) (*Block, MiningStats, error) {
 	var lastHash []byte
 	var lastHeight int
-	err := bc.db.View(func(tx *bolt.Tx) error {
+	var bits uint32
+	var timestamp int64
+	bc.mutex.RLock()
+	err := bc.db.View(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
-		blockData := b.Get(lastHash)
-		block, err := DeserializeBlock(blockData)
+		lastHash = fetchTipHash(b)
+		block, err := fetchBlock(b, lastHash)
 		if err != nil {
 			log.Printf("Error deserializing blockchain tip")
-			return nil
+			return err
 		}
 		lastHeight = block.Height
-		return nil
+		bits, timestamp, _, err = nextBlockTiming(bc.params, b, block, bc.timeSource)
+		return err
 	})
+	timeSource := bc.timeSource
+	bc.mutex.RUnlock()
 	if err != nil {
 		log.Printf("Error getting last block")
+		return nil, MiningStats{}, err
 	}
 
 	log.Printf("Previous Height: %d Previous Hash: %v", lastHeight, lastHash)
 
-	newBlock := NewBlock([]byte(lastHash), transactions, lastHeight+1)
+	// Validate the block template before spending any work on it
+	newBlock := newBlockTemplate(lastHash, transactions, lastHeight+1, bits, timestamp)
+	err = bc.ValidateBlock(newBlock, BFNoPoWCheck)
+	if err != nil {
+		return nil, MiningStats{}, err
+	}
 
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		block, err := newBlock.SerializeBlock()
-		if err != nil {
-			log.Printf("Error serializing new block")
-			return nil
-		}
-		err = b.Put(newBlock.Hash, block)
-		if err != nil {
-			log.Printf("Error updating bucket with new block")
-			return nil
-		}
-		err = b.Put([]byte("l"), newBlock.Hash)
-		if err != nil {
-			log.Printf("Error serializing genesis block")
-			return nil
-		}
-		bc.Tip = newBlock.Hash
+	// The lock is not held while mining, if the tip changes in the
+	// meantime the new block simply ends up in a side branch
+	stats, err := newBlock.Solve(ctx, workers, timeSource)
+	if err != nil {
+		return nil, stats, err
+	}
+	log.Printf("[POW] Block %x found after %d hashes in %v, %.0f hashes/s",
+		newBlock.Hash, stats.Hashes, stats.Elapsed, stats.HashRate())
 
-		return nil
-	})
+	err = bc.AddBlock(newBlock)
+	if err != nil {
+		return nil, stats, err
+	}
 
 	log.Printf("Update Tip: %d Latest Hash: %v", newBlock.Height, newBlock.Hash)
 
-	return newBlock
+	return newBlock, stats, nil
 }
 
-// AddBlock saves the block into the blockchain
-func (bc *Blockchain) AddBlock(block *Block) {
-	bc.mutex.Lock()
-	defer bc.mutex.Unlock()
-	err := bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockInDb := b.Get(block.Hash)
+// AddBlock saves the block into the blockchain.
+// The block is rejected if its parent is unknown or if its
+// proof of work does not meet the difficulty expected at its height.
+// The main chain is the one with the most cumulative work, if the
+// block makes a side branch overtake it the chain is reorganized.
+func (bc *Blockchain) AddBlock(block *Block) error {
+	var (
+		notifications []*Notification
+		tip           []byte
+	)
 
-		if blockInDb != nil {
-			return nil
-		}
+	bc.mutex.RLock()
+	timeSource := bc.timeSource
+	bc.mutex.RUnlock()
 
-		blockData, err := block.SerializeBlock()
-		if err != nil {
-			log.Panic(err)
-		}
-		err = b.Put(block.Hash, blockData)
-		if err != nil {
-			log.Panic(err)
-		}
+	err := CheckBlock(block, bc.params, timeSource, BFNone)
+	if err != nil {
+		return err
+	}
 
-		lastHash := b.Get([]byte("l"))
-		lastBlockData := b.Get(lastHash)
-		lastBlock, err := DeserializeBlock(lastBlockData)
+	bc.mutex.Lock()
+	err = bc.db.Update(func(tx database.Tx) error {
+		var err error
+		notifications, err = bc.acceptBlock(tx, block)
 		if err != nil {
-			log.Panic(err)
-		}
-		if block.Height > lastBlock.Height {
-			err = b.Put([]byte("l"), block.Hash)
-			if err != nil {
-				log.Panic(err)
-			}
-			bc.Tip = block.Hash
+			return err
 		}
 
+		tip = fetchTipHash(tx.Bucket([]byte(blocksBucket)))
 		return nil
 	})
+
+	// The tip only moves once the transaction is committed, a failed
+	// reorganization leaves it where the rolled back db has it
+	if err == nil {
+		bc.Tip = tip
+	}
+	bc.mutex.Unlock()
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
+
+	bc.updateAssumeValid(notifications)
+	bc.sendNotifications(notifications)
+
+	return nil
 }
 
-// AddGenesis saves the block into the blockchain
-func (bc *Blockchain) AddGenesis(block *Block) {
-	bc.mutex.Lock()
-	defer bc.mutex.Unlock()
-	err := bc.db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucket([]byte(blocksBucket))
+// acceptBlock stores the block and connects it to the main chain
+// when it extends the tip or when its branch has more work than the
+// main chain. It returns the notifications to send once the
+// transaction is committed.
+func (bc *Blockchain) acceptBlock(tx database.Tx, block *Block) ([]*Notification, error) {
+	b := tx.Bucket([]byte(blocksBucket))
+
+	if b.Get(block.Hash) != nil {
+		return nil, nil
+	}
+
+	prevBlock, err := fetchBlock(b, block.PrevBlockHash)
+	if err != nil {
+		prevBlock = nil
+	}
+
+	err = checkBlockContext(bc.params, b, block, prevBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCheckpoints(bc.params, b, block)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putBlock(b, block)
+	if err != nil {
+		return nil, err
+	}
+
+	prevWork, err := fetchChainWork(tx, prevBlock)
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int).Add(prevWork, calcWork(block.Bits))
+	err = putChainWork(tx, block.Hash, work)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := fetchBlock(b, fetchTipHash(b))
+	if err != nil {
+		return nil, err
+	}
+
+	// The common case, the block extends the main chain
+	if bytes.Equal(block.PrevBlockHash, tip.Hash) {
+		err = bc.connectBlock(tx, block)
 		if err != nil {
-			log.Printf("err creating blockchain bucket: %+v\n", err)
+			return nil, err
 		}
 
-		blockData, err := block.SerializeBlock()
+		return []*Notification{{Type: NTBlockConnected, Block: block}}, nil
+	}
+
+	tipWork, err := fetchChainWork(tx, tip)
+	if err != nil {
+		return nil, err
+	}
+
+	if work.Cmp(tipWork) <= 0 {
+		log.Printf("Block %x extends a side branch at height %d", block.Hash, block.Height)
+		return nil, nil
+	}
+
+	return bc.reorganizeChain(tx, tip, block)
+}
+
+// reorganizeChain disconnects the main chain blocks back to the point
+// where the branch ending in newTip forks from it and then connects
+// the blocks of that branch.
+func (bc *Blockchain) reorganizeChain(tx database.Tx, tip, newTip *Block) ([]*Notification, error) {
+	var notifications []*Notification
+
+	detach, attach, err := findFork(tx.Bucket([]byte(blocksBucket)), tip, newTip)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Reorganizing chain: disconnecting %d blocks, connecting %d blocks", len(detach), len(attach))
+
+	for _, block := range detach {
+		err = bc.disconnectBlock(tx, block)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
-		err = b.Put(block.Hash, blockData)
+		notifications = append(notifications, &Notification{Type: NTBlockDisconnected, Block: block})
+	}
+
+	for _, block := range attach {
+		err = bc.connectBlock(tx, block)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
+		notifications = append(notifications, &Notification{Type: NTBlockConnected, Block: block})
+	}
 
-		err = b.Put([]byte("l"), block.Hash)
-		if err != nil {
-			log.Panic(err)
+	return notifications, nil
+}
+
+// findFork returns the blocks to disconnect from the main chain, from
+// tip down, and the blocks to connect, from the fork point up to newTip.
+func findFork(b database.Bucket, tip, newTip *Block) ([]*Block, []*Block, error) {
+	var detach, attach []*Block
+	var err error
+
+	for tip.Height > newTip.Height {
+		detach = append(detach, tip)
+		if tip, err = fetchBlock(b, tip.PrevBlockHash); err != nil {
+			return nil, nil, err
 		}
-		bc.Tip = block.Hash
+	}
 
-		return nil
-	})
+	for newTip.Height > tip.Height {
+		attach = append([]*Block{newTip}, attach...)
+		if newTip, err = fetchBlock(b, newTip.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for !bytes.Equal(tip.Hash, newTip.Hash) {
+		detach = append(detach, tip)
+		attach = append([]*Block{newTip}, attach...)
+		if tip, err = fetchBlock(b, tip.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+		if newTip, err = fetchBlock(b, newTip.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return detach, attach, nil
+}
+
+// connectBlock updates the UTXO set with the block and makes it the tip
+// of the db, the caller updates bc.Tip once the transaction is committed
+func (bc *Blockchain) connectBlock(tx database.Tx, block *Block) error {
+	utxo, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	// The signatures of the ancestors of the assume-valid block
+	// are covered by its proof of work
+	flags := BFNone
+	if bc.isAssumedValid(tx.Bucket([]byte(blocksBucket)), block) {
+		flags |= BFNoSigCheck
+	}
+
+	err = checkConnectBlock(bc.params, utxo, block, flags)
+	if err != nil {
+		return err
+	}
+
+	undo, err := connectTransactions(utxo, block)
+	if err != nil {
+		return err
+	}
+
+	err = putBlockUndo(tx, block.Hash, undo)
+	if err != nil {
+		return err
+	}
+
+	err = putHeightIndex(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = indexBlockTransactions(tx, block)
+	if err != nil {
+		return err
 	}
+
+	err = indexBlockAddresses(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), block.Hash)
+}
+
+// disconnectBlock reverts the block from the UTXO set and makes its parent
+// the tip of the db, the caller updates bc.Tip once the transaction is committed
+func (bc *Blockchain) disconnectBlock(tx database.Tx, block *Block) error {
+	utxo, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+	if err != nil {
+		return err
+	}
+
+	undo, err := fetchBlockUndo(tx, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = disconnectTransactions(utxo, block, undo)
+	if err != nil {
+		return err
+	}
+
+	err = deleteBlockUndo(tx, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = deleteHeightIndex(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = unindexBlockTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	err = unindexBlockAddresses(tx, block)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), block.PrevBlockHash)
+}
+
+// initGenesis creates the buckets of a new chain and connects the genesis block
+func (bc *Blockchain) initGenesis(tx database.Tx, genesis *Block) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(blocksBucket))
+	if err != nil {
+		return err
+	}
+
+	err = putBlock(b, genesis)
+	if err != nil {
+		return err
+	}
+
+	err = putChainWork(tx, genesis.Hash, calcWork(genesis.Bits))
+	if err != nil {
+		return err
+	}
+
+	return bc.connectBlock(tx, genesis)
 }
 
 // FindTransaction is used to get a Transaction by the given transaction hash
@@ -246,23 +599,36 @@ func (bc *Blockchain) AddGenesis(block *Block) {
 func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error) {
 	bc.mutex.RLock()
 	defer bc.mutex.RUnlock()
-	bci := bc.Iterator()
 
-	for {
-		block := bci.Next()
+	tx, err := bc.findTransaction(ID)
+	if err != nil {
+		return transaction.Transaction{}, err
+	}
 
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
-		}
+	return *tx, nil
+}
 
-		if len(block.PrevBlockHash) == 0 {
-			break
+// findTransaction looks for a transaction in the main chain, using
+// the transaction index when there is one. The chain lock must be held.
+func (bc *Blockchain) findTransaction(ID []byte) (*transaction.Transaction, error) {
+	var found *transaction.Transaction
+
+	err := bc.db.View(func(tx database.Tx) error {
+		var (
+			err     error
+			indexed bool
+		)
+
+		found, indexed, err = fetchIndexedTransaction(tx, ID)
+		if indexed {
+			return err
 		}
-	}
 
-	return transaction.Transaction{}, errors.New("transaction was not found")
+		found, _, err = findTransactionFrom(tx.Bucket([]byte(blocksBucket)), bc.Tip, ID)
+		return err
+	})
+
+	return found, err
 }
 
 // FindPreviousTransactions is used to get the previous transactions associated with the passed
@@ -273,32 +639,26 @@ func (bc *Blockchain) FindPreviousTransactions(tx *transaction.Transaction) (map
 	prevTXs := make(map[string]transaction.Transaction)
 
 	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
+		prevTX, err := bc.findTransaction(vin.Txid)
 		if err != nil {
 			log.Printf("Error finding for transaction")
+			return nil, err
 		}
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+		prevTXs[hex.EncodeToString(prevTX.ID)] = *prevTX
 	}
 
 	return prevTXs, nil
 }
 
-//VerifyTransaction is used to verify the given transaction
+// VerifyTransaction is used to verify the given transaction
 func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) bool {
-	bc.mutex.Lock()
-	defer bc.mutex.Unlock()
 	if tx.IsCoinbase() {
 		return true
 	}
 
-	prevTXs := make(map[string]transaction.Transaction)
-
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			log.Printf("Error finding for transaction")
-		}
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	prevTXs, err := bc.FindPreviousTransactions(tx)
+	if err != nil {
+		return false
 	}
 
 	return tx.Verify(prevTXs)
@@ -306,7 +666,7 @@ func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) bool {
 
 // BlockchainIterator is the struct defining
 // the iterator used to iterate over all the keys
-// in a boltdb bucket
+// in a database bucket
 type BlockchainIterator struct {
 	currentHash []byte
 	db          *Blockchain
@@ -329,7 +689,7 @@ func (i *BlockchainIterator) Next() *Block {
 	defer i.db.mutex.RUnlock()
 	var block *Block
 
-	err := i.db.db.View(func(tx *bolt.Tx) error {
+	err := i.db.db.View(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		encodedBlock := b.Get(i.currentHash)
 		nblock, err := DeserializeBlock(encodedBlock)
@@ -350,108 +710,36 @@ func (i *BlockchainIterator) Next() *Block {
 	return block
 }
 
-// FindUTXO finds and returns all unspent transaction outputs
-func (bc *Blockchain) FindUTXO() map[string]transaction.TXOutputs {
-	bc.mutex.RLock()
-	defer bc.mutex.RUnlock()
-	unspentOutputs := make(map[string]transaction.TXOutputs)
-	spentOutputs := make(map[string][]int)
-	bci := bc.Iterator()
-
-	for {
-		block := bci.Next()
-
-		for _, tx := range block.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-
-		Outputs:
-			for outIdx, out := range tx.Vout {
-				// Was the output spent?
-				if spentOutputs[txID] != nil {
-					for _, spentOutIdx := range spentOutputs[txID] {
-						if spentOutIdx == outIdx {
-							continue Outputs
-						}
-					}
-				}
-
-				outs := unspentOutputs[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				unspentOutputs[txID] = outs
-			}
-
-			if tx.IsCoinbase() == false {
-				for _, in := range tx.Vin {
-					inTxID := hex.EncodeToString(in.Txid)
-					spentOutputs[inTxID] = append(spentOutputs[inTxID], in.Vout)
-				}
-			}
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
-	}
-
-	return unspentOutputs
-}
-
-// CreateBlockchain creates a new blockchain
-func CreateBlockchain(address string) (*Blockchain, error) {
-	dbFile := fmt.Sprintf("%s%s", blocksBucket, bucketExtension)
-
-	if fileExists(dbFile) {
+// CreateBlockchain creates a new blockchain of the given network
+// in a db file at the given path, which must not exist
+func CreateBlockchain(path string, params *chaincfg.Params) (*Blockchain, error) {
+	if fileExists(path) {
 		return &Blockchain{}, errors.New("blockchain already exists")
 	}
 
-	var tip []byte
-
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := database.OpenBolt(path)
 	if err != nil {
 		log.Printf("err opening db: %+v\n", err)
 		return &Blockchain{}, err
 	}
 
-	if address != "" {
-
-		coinbaseTx := transaction.NewCoinbaseTX(address, genesisCoinbaseData)
-		genesis := genesisBlock(coinbaseTx)
-
-		err = db.Update(func(tx *bolt.Tx) error {
-
-			b, err := tx.CreateBucket([]byte(blocksBucket))
-			if err != nil {
-				log.Printf("err creating blockchain bucket: %+v\n", err)
-			}
-			ser, err := genesis.SerializeBlock()
-			if err != nil {
-				log.Printf("err serializing genesis block: %+v\n", err)
-			}
-			err = b.Put(genesis.Hash, ser)
-			if err != nil {
-				log.Printf("err updating genesis hash: %+v\n", err)
-			}
+	return CreateBlockchainWithDB(db, params)
+}
 
-			err = b.Put([]byte("l"), genesis.Hash)
-			if err != nil {
-				log.Printf("err updating last block hash: %+v\n", err)
-			}
-			tip = genesis.Hash
-
-			return nil
-		})
-	}
+// CreateBlockchainWithDB creates a new blockchain of the given
+// network in the given store, holding only its genesis block
+func CreateBlockchainWithDB(db database.DB, params *chaincfg.Params) (*Blockchain, error) {
+	bc := newBlockchain(db, params, nil)
+	genesis := genesisBlock(params)
 
+	err := db.Update(func(tx database.Tx) error {
+		return bc.initGenesis(tx, genesis)
+	})
 	if err != nil {
 		log.Printf("err in blockchain creation db method: %+v\n", err)
 		return &Blockchain{}, err
 	}
-
-	bc := &Blockchain{
-		Tip:   tip,
-		db:    db,
-		mutex: &sync.RWMutex{},
-	}
+	bc.Tip = genesis.Hash
 
 	return bc, nil
 }
@@ -461,32 +749,50 @@ func CreateBlockchain(address string) (*Blockchain, error) {
 // if so gets the current blockchain tip,
 // else generates the genesis block and
 // sets it as the tip
-func NewBlockchain(path string) (*Blockchain, error) {
+func NewBlockchain(path string, params *chaincfg.Params) (*Blockchain, error) {
 	if fileExists(path) == false {
 		return nil, errors.New(noExistingBlockchainFound)
 	}
 
-	var tip []byte
-	db, err := bolt.Open(path, 0600, nil)
+	db, err := database.OpenBolt(path)
 	if err != nil {
 		log.Printf("err opening db: %+v\n", err)
 		return nil, err
 	}
-	err = db.Update(func(tx *bolt.Tx) error {
+
+	return NewBlockchainWithDB(db, params)
+}
+
+// NewBlockchainWithDB loads the blockchain stored in the given
+// store, which must belong to the given network
+func NewBlockchainWithDB(db database.DB, params *chaincfg.Params) (*Blockchain, error) {
+	var tip []byte
+
+	err := db.Update(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("l"))
+		if b == nil {
+			return errors.New(noExistingBlockchainFound)
+		}
+		tip = fetchTipHash(b)
+
+		err := buildHeightIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		genesisHash, err := fetchHashByHeight(tx, 0)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(genesisHash, params.GenesisHash) {
+			return fmt.Errorf("blockchain does not belong to %s, its genesis block is %x", params.Name, genesisHash)
+		}
+
 		return nil
 	})
-
 	if err != nil {
-		log.Panic(err)
-	}
-
-	bc := Blockchain{
-		Tip:   tip,
-		db:    db,
-		mutex: &sync.RWMutex{},
+		return nil, err
 	}
 
-	return &bc, nil
+	return newBlockchain(db, params, tip), nil
 }
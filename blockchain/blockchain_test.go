@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMemoryChain mines a few blocks on a chain kept in memory
+// and checks they are found again once the chain is reopened
+func TestMemoryChain(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	db := database.NewMemory()
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(db, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks []*Block
+	for i := 0; i < 3; i++ {
+		coinbase := transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(i+1, params))
+		block, err := bc.MineBlock([]*transaction.Transaction{coinbase})
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	reopened, err := NewBlockchainWithDB(db, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, blocks[2].Hash, reopened.Tip)
+	assert.Equal(t, 3, reopened.GetBestHeight())
+
+	for _, block := range blocks {
+		hash, err := reopened.GetBlockHashByHeight(block.Height)
+		assert.NoError(t, err)
+		assert.Equal(t, block.Hash, hash)
+	}
+
+	_, err = NewBlockchainWithDB(database.NewMemory(), params)
+	assert.Error(t, err)
+
+	_, err = NewBlockchainWithDB(db, &chaincfg.MainNetParams)
+	assert.Error(t, err, "Chain of another network is not loaded")
+}
+
+// reorgChain returns a chain with CoinbaseMaturity 1 whose main chain is
+// a1 and a2, a2 spending the coinbase of a1, both paying to a
+func reorgChain(t *testing.T, a *address.Address) (*Blockchain, *chaincfg.Params, []*Block) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a1, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend := signedSpend(t, a, a1.Transactions[0], a1.Transactions[0].Vout[0].Value)
+	a2, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(2, params)), spend})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bc, params, []*Block{a1, a2}
+}
+
+// sideBranch returns n blocks forking from the genesis block, paying
+// value to addr at each height
+func sideBranch(params *chaincfg.Params, addr string, n int, value func(height int) int) []*Block {
+	genesis := genesisBlock(params)
+
+	var blocks []*Block
+	prev := genesis
+	for height := 1; height <= n; height++ {
+		coinbase := transaction.NewCoinbaseTX(addr, fmt.Sprintf("side %d", height), value(height))
+		block := NewBlock(prev.Hash, []*transaction.Transaction{coinbase}, height, params.PowLimitBits, genesis.Timestamp+int64(height))
+		blocks = append(blocks, block)
+		prev = block
+	}
+
+	return blocks
+}
+
+// TestReorganizeChain checks a side branch with more work replaces the
+// main chain, undoing its blocks, and that a reorganization failing
+// partway leaves the chain as it was
+func TestReorganizeChain(t *testing.T) {
+	a := address.NewAddress()
+	b := address.NewAddress()
+	bc, params, main := reorgChain(t, a)
+	utxoSet := &UTXOSet{Chain: bc}
+	assert.Len(t, utxoSet.FindUTXO(address.HashPubKey(a.PublicKey)), 2)
+
+	var disconnected, connected [][]byte
+	bc.Subscribe(func(n *Notification) {
+		switch n.Type {
+		case NTBlockDisconnected:
+			disconnected = append(disconnected, n.Block.Hash)
+		case NTBlockConnected:
+			connected = append(connected, n.Block.Hash)
+		}
+	})
+
+	side := sideBranch(params, string(b.GetAddress(params.AddressVersion)), 3, func(height int) int {
+		return CalcBlockSubsidy(height, params)
+	})
+	for _, block := range side[:2] {
+		assert.NoError(t, bc.AddBlock(block))
+	}
+	assert.Equal(t, main[1].Hash, bc.Tip, "Side branch with as much work is not connected")
+
+	assert.NoError(t, bc.AddBlock(side[2]))
+	assert.Equal(t, side[2].Hash, bc.Tip)
+	assert.Equal(t, [][]byte{main[1].Hash, main[0].Hash}, disconnected)
+	assert.Equal(t, [][]byte{side[0].Hash, side[1].Hash, side[2].Hash}, connected)
+	for _, block := range side {
+		hash, err := bc.GetBlockHashByHeight(block.Height)
+		assert.NoError(t, err)
+		assert.Equal(t, block.Hash, hash)
+	}
+	assert.Empty(t, utxoSet.FindUTXO(address.HashPubKey(a.PublicKey)), "Outputs of the old branch are undone")
+	assert.Len(t, utxoSet.FindUTXO(address.HashPubKey(b.PublicKey)), 3)
+
+	// A branch whose last block overpays its coinbase fails to connect
+	bad := sideBranch(params, string(a.GetAddress(params.AddressVersion)), 4, func(height int) int {
+		if height == 4 {
+			return CalcBlockSubsidy(height, params) + 1
+		}
+		return CalcBlockSubsidy(height, params)
+	})
+	for _, block := range bad[:3] {
+		assert.NoError(t, bc.AddBlock(block))
+	}
+	err := bc.AddBlock(bad[3])
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCoinbaseValue, err.(RuleError).ErrorCode)
+	}
+
+	assert.Equal(t, side[2].Hash, bc.Tip, "Tip is unchanged")
+	reopened, err := NewBlockchainWithDB(bc.db, params)
+	if assert.NoError(t, err) {
+		assert.Equal(t, side[2].Hash, reopened.Tip, "Stored tip is unchanged")
+	}
+	hash, err := bc.GetBlockHashByHeight(3)
+	assert.NoError(t, err)
+	assert.Equal(t, side[2].Hash, hash)
+	assert.Empty(t, utxoSet.FindUTXO(address.HashPubKey(a.PublicKey)))
+	assert.Len(t, utxoSet.FindUTXO(address.HashPubKey(b.PublicKey)), 3)
+}
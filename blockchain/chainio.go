@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// fetchBlock loads the block with the given hash from the blocks bucket
+func fetchBlock(b database.Bucket, hash []byte) (*Block, error) {
+	blockData := b.Get(hash)
+	if blockData == nil {
+		return nil, errors.New("block not found")
+	}
+
+	return DeserializeBlock(blockData)
+}
+
+// putBlock stores the block in the blocks bucket
+func putBlock(b database.Bucket, block *Block) error {
+	blockData, err := block.SerializeBlock()
+	if err != nil {
+		return err
+	}
+
+	return b.Put(block.Hash, blockData)
+}
+
+// fetchTipHash returns the hash of the main chain tip.
+// The returned slice is a copy, safe to use after the transaction ends.
+func fetchTipHash(b database.Bucket) []byte {
+	return append([]byte{}, b.Get([]byte("l"))...)
+}
+
+// fetchChainWork returns the cumulative work of the chain ending in the
+// given block. Blocks stored before the work was tracked have it
+// computed by walking back to the closest ancestor which has it.
+func fetchChainWork(tx database.Tx, block *Block) (*big.Int, error) {
+	workBucket := tx.Bucket([]byte(chainWorkBucket))
+	blocks := tx.Bucket([]byte(blocksBucket))
+	work := big.NewInt(0)
+
+	for {
+		if workBucket != nil {
+			if stored := workBucket.Get(block.Hash); stored != nil {
+				return work.Add(work, new(big.Int).SetBytes(stored)), nil
+			}
+		}
+
+		work.Add(work, calcWork(block.Bits))
+		if len(block.PrevBlockHash) == 0 {
+			return work, nil
+		}
+
+		prev, err := fetchBlock(blocks, block.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+		block = prev
+	}
+}
+
+// putChainWork stores the cumulative work of the chain ending in the given block
+func putChainWork(tx database.Tx, hash []byte, work *big.Int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(chainWorkBucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put(hash, work.Bytes())
+}
+
+// heightKey returns the key of the given height in the height bucket,
+// big endian so the cursor walks the main chain in order
+func heightKey(height int) []byte {
+	var key [4]byte
+	binary.BigEndian.PutUint32(key[:], uint32(height))
+	return key[:]
+}
+
+// fetchHashByHeight returns the hash of the main chain block at the
+// given height. The returned slice is a copy, safe to use after the
+// transaction ends.
+func fetchHashByHeight(tx database.Tx, height int) ([]byte, error) {
+	b := tx.Bucket([]byte(heightBucket))
+	if b == nil || height < 0 {
+		return nil, errors.New("block not found")
+	}
+
+	hash := b.Get(heightKey(height))
+	if hash == nil {
+		return nil, errors.New("block not found")
+	}
+
+	return append([]byte{}, hash...), nil
+}
+
+// putHeightIndex records the block as the main chain block at its height
+func putHeightIndex(tx database.Tx, block *Block) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(heightBucket))
+	if err != nil {
+		return err
+	}
+
+	return b.Put(heightKey(block.Height), block.Hash)
+}
+
+// deleteHeightIndex removes the block from the height index
+func deleteHeightIndex(tx database.Tx, block *Block) error {
+	b := tx.Bucket([]byte(heightBucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete(heightKey(block.Height))
+}
+
+// buildHeightIndex indexes the main chain by height, walking it back
+// from the tip. It is used for chains stored before the index existed.
+func buildHeightIndex(tx database.Tx) error {
+	if tx.Bucket([]byte(heightBucket)) != nil {
+		return nil
+	}
+
+	blocks := tx.Bucket([]byte(blocksBucket))
+	hash := fetchTipHash(blocks)
+	for len(hash) != 0 {
+		block, err := fetchBlock(blocks, hash)
+		if err != nil {
+			return err
+		}
+
+		err = putHeightIndex(tx, block)
+		if err != nil {
+			return err
+		}
+
+		hash = block.PrevBlockHash
+	}
+
+	return nil
+}
+
+// findTransactionFrom looks for a transaction walking the chain back
+// from the block with the given hash, which is included in the search
+func findTransactionFrom(b database.Bucket, hash, ID []byte) (*transaction.Transaction, int, error) {
+	for len(hash) != 0 {
+		block, err := fetchBlock(b, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return tx, block.Height, nil
+			}
+		}
+
+		hash = block.PrevBlockHash
+	}
+
+	return nil, 0, errors.New("transaction was not found")
+}
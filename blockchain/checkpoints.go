@@ -0,0 +1,165 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+)
+
+// checkpointAt returns the checkpoint of the network at
+// the given height, or nil if there is none
+func checkpointAt(params *chaincfg.Params, height int) *chaincfg.Checkpoint {
+	for i := range params.Checkpoints {
+		if params.Checkpoints[i].Height == height {
+			return &params.Checkpoints[i]
+		}
+	}
+
+	return nil
+}
+
+// latestCheckpoint returns the highest checkpoint of the network
+// at or below the given height, or nil if there is none
+func latestCheckpoint(params *chaincfg.Params, height int) *chaincfg.Checkpoint {
+	var latest *chaincfg.Checkpoint
+	for i := range params.Checkpoints {
+		if params.Checkpoints[i].Height <= height {
+			latest = &params.Checkpoints[i]
+		}
+	}
+
+	return latest
+}
+
+// checkCheckpoints checks the block against the checkpoints of the
+// network: a block at the height of a checkpoint must be the checkpoint
+// block and no block may fork from the main chain at or below the latest
+// checkpoint the main chain has reached.
+func checkCheckpoints(params *chaincfg.Params, b database.Bucket, block *Block) error {
+	checkpoint := checkpointAt(params, block.Height)
+	if checkpoint != nil && !bytes.Equal(checkpoint.Hash, block.Hash) {
+		return ruleError(ErrBadCheckpoint, fmt.Sprintf("block %x at height %d does not match checkpoint %x",
+			block.Hash, block.Height, checkpoint.Hash))
+	}
+
+	tip, err := fetchBlock(b, fetchTipHash(b))
+	if err != nil {
+		return err
+	}
+
+	checkpoint = latestCheckpoint(params, tip.Height)
+	if checkpoint != nil && block.Height <= checkpoint.Height {
+		return ruleError(ErrForkTooOld, fmt.Sprintf("block %x at height %d forks below checkpoint at height %d",
+			block.Hash, block.Height, checkpoint.Height))
+	}
+
+	return nil
+}
+
+// lookupBlock returns the block with the given hash from the block
+// store or from the orphan pool. The orphan lock must be held.
+func (bc *Blockchain) lookupBlock(b database.Bucket, hash []byte) *Block {
+	if orphan, exists := bc.orphans[hex.EncodeToString(hash)]; exists {
+		return orphan.block
+	}
+
+	block, err := fetchBlock(b, hash)
+	if err != nil {
+		return nil
+	}
+
+	return block
+}
+
+// assumeValidAncestry caches the part of the ancestry of the
+// assume-valid block known so far, walked down once
+type assumeValidAncestry struct {
+	// hashes holds the known ancestors of the assume-valid block,
+	// the block itself included
+	hashes map[string]struct{}
+
+	// next is the hash of the ancestor the walk continues with once
+	// it is known, nil when the walk reached the genesis block
+	next []byte
+
+	// passed is set once the connection of the assume-valid block is
+	// committed, every signature is checked from then on
+	passed bool
+}
+
+// isInitialBlockDownload returns whether the tip is older than
+// maxTipAge, the chain catching up with the network. The chain
+// lock must be held.
+func (bc *Blockchain) isInitialBlockDownload(b database.Bucket) bool {
+	tip, err := fetchBlock(b, fetchTipHash(b))
+	if err != nil {
+		return false
+	}
+
+	return bc.timeSource.AdjustedTime().Sub(time.Unix(tip.Timestamp, 0)) > maxTipAge
+}
+
+// isAssumedValid returns whether the block is an ancestor of the
+// assume-valid block of the network, connected during the initial
+// block download. Blocks are downloaded newest first, so the
+// assume-valid block is usually waiting in the orphan pool while its
+// ancestors are connected. The ancestry is only walked as far as the
+// blocks known, each block once, and once the assume-valid block is
+// connected no block is assumed valid anymore. The chain lock must
+// be held.
+func (bc *Blockchain) isAssumedValid(b database.Bucket, block *Block) bool {
+	if len(bc.params.AssumeValid) == 0 || !bc.isInitialBlockDownload(b) {
+		return false
+	}
+
+	bc.orphanMutex.Lock()
+	defer bc.orphanMutex.Unlock()
+
+	av := &bc.assumeValid
+	if av.passed {
+		return false
+	}
+	if av.hashes == nil {
+		av.hashes = make(map[string]struct{})
+		av.next = bc.params.AssumeValid
+	}
+
+	for av.next != nil {
+		ancestor := bc.lookupBlock(b, av.next)
+		if ancestor == nil {
+			break
+		}
+
+		av.hashes[hex.EncodeToString(ancestor.Hash)] = struct{}{}
+		av.next = ancestor.PrevBlockHash
+		if len(av.next) == 0 {
+			av.next = nil
+		}
+	}
+
+	_, ancestor := av.hashes[hex.EncodeToString(block.Hash)]
+	return ancestor
+}
+
+// updateAssumeValid stops assuming blocks valid once the assume-valid
+// block is connected. It is given the notifications of a committed
+// db transaction, so a rolled back connection changes nothing.
+func (bc *Blockchain) updateAssumeValid(notifications []*Notification) {
+	if len(bc.params.AssumeValid) == 0 {
+		return
+	}
+
+	for _, n := range notifications {
+		if n.Type == NTBlockConnected && bytes.Equal(n.Block.Hash, bc.params.AssumeValid) {
+			bc.orphanMutex.Lock()
+			bc.assumeValid.passed = true
+			bc.assumeValid.hashes = nil
+			bc.orphanMutex.Unlock()
+			return
+		}
+	}
+}
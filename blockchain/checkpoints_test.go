@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCheckpoints checks a block at a checkpoint height must be the
+// checkpoint block and no branch may fork below a reached checkpoint
+func TestCheckpoints(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.Checkpoints = []chaincfg.Checkpoint{{Height: 2, Hash: make([]byte, 32)}}
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoint := NewBlock(block.Hash, []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(2, params))},
+		2, params.PowLimitBits, block.Timestamp+1)
+	err = bc.AddBlock(checkpoint)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCheckpoint, err.(RuleError).ErrorCode, "Block not matching the checkpoint is rejected")
+	}
+
+	params.Checkpoints[0].Hash = checkpoint.Hash
+	assert.NoError(t, bc.AddBlock(checkpoint))
+
+	// A branch forking from the genesis block is now too old
+	genesis := genesisBlock(params)
+	fork := NewBlock(genesis.Hash, []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "fork", CalcBlockSubsidy(1, params))},
+		1, params.PowLimitBits, block.Timestamp)
+	err = bc.AddBlock(fork)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrForkTooOld, err.(RuleError).ErrorCode, "Fork below the checkpoint is rejected")
+	}
+
+	_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(3, params))})
+	assert.NoError(t, err, "Main chain is extended past the checkpoint")
+}
+
+// TestAssumeValid checks the signatures of the ancestors of the
+// assume-valid block are not verified, and only theirs
+func TestAssumeValid(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	miner, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	funding, err := miner.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unsigned spend of the funding coinbase and a block on top
+	prev := funding.Transactions[0]
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}},
+		Vout: []transaction.TXOutput{{Value: prev.Vout[0].Value, PubKeyHash: address.HashPubKey(a.PublicKey)}},
+	}
+	tx.ID = tx.Hash()
+	unsigned := NewBlock(funding.Hash, []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(2, params)), tx},
+		2, params.PowLimitBits, funding.Timestamp+1)
+	child := NewBlock(unsigned.Hash, []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(3, params))},
+		3, params.PowLimitBits, funding.Timestamp+2)
+
+	err = miner.AddBlock(unsigned)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadSignature, err.(RuleError).ErrorCode, "Unsigned spend is rejected")
+	}
+
+	// assumeValidChain returns a chain assuming the given block valid,
+	// the funding block connected, whose clock is at the given time
+	assumeValidChain := func(hash []byte, now time.Time) *Blockchain {
+		assumeParams := new(chaincfg.Params)
+		*assumeParams = *params
+		assumeParams.AssumeValid = hash
+
+		bc, err := CreateBlockchainWithDB(database.NewMemory(), assumeParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock := NewMockClock()
+		clock.SetMockTime(now)
+		bc.SetTimeSource(NewMedianTime(clock))
+		assert.NoError(t, bc.AddBlock(funding))
+
+		return bc
+	}
+	syncing := time.Unix(funding.Timestamp, 0).Add(2 * maxTipAge)
+
+	// Once synced, signatures are checked whatever the assume-valid block
+	synced := assumeValidChain(child.Hash, time.Unix(funding.Timestamp, 0))
+	orphan, err := synced.ProcessBlock(child)
+	assert.NoError(t, err)
+	assert.True(t, orphan)
+	_, err = synced.ProcessBlock(unsigned)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadSignature, err.(RuleError).ErrorCode, "Unsigned spend is rejected once synced")
+	}
+
+	// An assume-valid block failing to connect is not passed
+	greedy := NewBlock(funding.Hash, []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(2, params)+1)},
+		2, params.PowLimitBits, funding.Timestamp+1)
+	rolledBack := assumeValidChain(greedy.Hash, syncing)
+	err = rolledBack.AddBlock(greedy)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCoinbaseValue, err.(RuleError).ErrorCode)
+	}
+	assert.False(t, rolledBack.assumeValid.passed, "Rolled back connection does not pass the assume-valid block")
+
+	// A node assuming the child valid receives the blocks newest first
+	bc := assumeValidChain(child.Hash, syncing)
+
+	orphan, err = bc.ProcessBlock(child)
+	assert.NoError(t, err)
+	assert.True(t, orphan)
+
+	_, err = bc.ProcessBlock(unsigned)
+	assert.NoError(t, err, "Ancestor of the assume-valid block is accepted")
+	assert.Equal(t, child.Hash, bc.Tip)
+	assert.True(t, bc.assumeValid.passed)
+
+	// Past the assume-valid block, signatures are checked again
+	err = bc.db.View(func(tx database.Tx) error {
+		assert.False(t, bc.isAssumedValid(tx.Bucket([]byte(blocksBucket)), unsigned))
+		return nil
+	})
+	assert.NoError(t, err)
+}
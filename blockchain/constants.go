@@ -1,16 +1,70 @@
 package blockchain
 
-import "math"
+import (
+	"math"
+	"time"
+)
+
+// Exported constants
+const (
+	// DBFileName is the name of the chain database file in a data directory
+	DBFileName = "blockchain.db"
+
+	// MaxBlockSize is the maximum size in bytes of a serialized block
+	MaxBlockSize = 1000000
+
+	// MaxMoney is the maximum value of an output and of any sum of
+	// values, above the subsidies any network will ever issue
+	MaxMoney = 21000000
+)
 
 // Unexported constants
 const (
-	blocksBucket        = "blockchain"
-	targetBits          = 1
-	utxoBucket          = "utxo"
-	bucketExtension     = ".db"
-	genesisCoinbaseData = "May 7 2019, 10:00pm, The Times	Jürgen Klopp makes Liverpool believe they can do the impossible		Matt Dickinson, Chief Sports Writer"
+	blocksBucket    = "blockchain"
+	utxoBucket      = "utxo"
+	chainWorkBucket = "chainwork"
+	undoBucket      = "undo"
+	heightBucket    = "height"
+	txIndexBucket   = "txindex"
+	addrIndexBucket = "addrindex"
+
+	// maxOrphanBlocks is the maximum amount of orphan blocks kept in memory
+	maxOrphanBlocks = 100
+	// maxTimeOffset is how far ahead of the network-adjusted
+	// time a block's timestamp can be
+	maxTimeOffset = 2 * time.Hour
+	// medianTimeBlocks is the number of previous blocks whose median
+	// timestamp a block's timestamp must be after
+	medianTimeBlocks = 11
+	// maxTimeSamples is the number of peer time samples kept
+	maxTimeSamples = 200
+	// minTimeSamples is the number of peer time samples needed
+	// before the local clock is adjusted
+	minTimeSamples = 5
+	// maxAllowedTimeOffset is the largest offset applied to the
+	// local clock, beyond it the peers are not trusted
+	maxAllowedTimeOffset = 70 * time.Minute
+	// orphanExpiration is how long an orphan block is kept waiting for its parent
+	orphanExpiration = time.Hour
+	// maxTipAge is how far behind the network-adjusted time the tip
+	// can be before the chain is considered to be catching up with
+	// the network, in its initial block download
+	maxTipAge = 24 * time.Hour
+
+	// blockVersion is the version of the blocks created by this node
+	blockVersion = 1
+	// blockHeaderLen is the length of a serialized block header
+	blockHeaderLen = 84
+	// maxBlockTransactions is the maximum number of transactions in a block
+	maxBlockTransactions = 100000
+	// coinbaseReserveSize is the space left for the coinbase and the
+	// header when filling a block with transactions
+	coinbaseReserveSize = 1000
+	// hashCheckInterval is the number of hashes a mining worker computes
+	// between checks of whether the search was cancelled
+	hashCheckInterval = 1 << 12
 )
 
 var (
-	maxNonce = math.MaxInt64
+	maxNonce = uint32(math.MaxUint32)
 )
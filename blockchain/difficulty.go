@@ -0,0 +1,156 @@
+package blockchain
+
+import (
+	"math/big"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+)
+
+// CompactToBig converts the compact representation of a target, as stored
+// in a block's Bits field, into a big integer.
+// The compact format is a base-256 floating point number: the most
+// significant byte is the exponent, bit 23 is the sign and the
+// remaining 23 bits are the mantissa.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var bn *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		bn = big.NewInt(int64(mantissa))
+	} else {
+		bn = big.NewInt(int64(mantissa))
+		bn.Lsh(bn, 8*(exponent-3))
+	}
+
+	if isNegative {
+		bn = bn.Neg(bn)
+	}
+
+	return bn
+}
+
+// BigToCompact converts a target into its compact representation.
+// It is the inverse of CompactToBig, losing any precision which
+// does not fit in the 23 bit mantissa.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Set(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// When the sign bit is set the number would be interpreted as
+	// negative, so shift the mantissa and bump the exponent instead
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// calcNextRequiredBits returns the difficulty bits a block built on top
+// of prev must carry. The difficulty only changes every RetargetInterval
+// blocks, when the target is scaled by how long the previous window
+// actually took compared to the target timespan of the network.
+// A nil prev means the next block is the genesis block.
+func calcNextRequiredBits(params *chaincfg.Params, b database.Bucket, prev *Block) (uint32, error) {
+	if prev == nil || params.NoRetargeting {
+		return params.PowLimitBits, nil
+	}
+
+	if (prev.Height+1)%params.RetargetInterval != 0 {
+		return prev.Bits, nil
+	}
+
+	// Walk back to the first block of the window which is
+	// about to be closed
+	first := prev
+	for i := 0; i < params.RetargetInterval && len(first.PrevBlockHash) != 0; i++ {
+		block, err := fetchBlock(b, first.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		first = block
+	}
+
+	targetTimespan := params.TargetTimespan()
+	minRetargetTimespan := targetTimespan / params.RetargetAdjustmentFactor
+	maxRetargetTimespan := targetTimespan * params.RetargetAdjustmentFactor
+
+	actualTimespan := prev.Timestamp - first.Timestamp
+	if actualTimespan < minRetargetTimespan {
+		actualTimespan = minRetargetTimespan
+	} else if actualTimespan > maxRetargetTimespan {
+		actualTimespan = maxRetargetTimespan
+	}
+
+	newTarget := CompactToBig(prev.Bits)
+	newTarget.Mul(newTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+
+	if newTarget.Cmp(params.PowLimit) > 0 {
+		newTarget.Set(params.PowLimit)
+	}
+
+	return BigToCompact(newTarget), nil
+}
+
+// CalcNextRequiredBits returns the difficulty bits expected for
+// a block whose parent is the block with the given hash.
+// An empty hash refers to the genesis block.
+func (bc *Blockchain) CalcNextRequiredBits(prevBlockHash []byte) (uint32, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var bits uint32
+
+	err := bc.db.View(func(tx database.Tx) error {
+		var (
+			prev *Block
+			err  error
+		)
+		b := tx.Bucket([]byte(blocksBucket))
+
+		if len(prevBlockHash) != 0 {
+			prev, err = fetchBlock(b, prevBlockHash)
+			if err != nil {
+				return err
+			}
+		}
+
+		bits, err = calcNextRequiredBits(bc.params, b, prev)
+		return err
+	})
+
+	return bits, err
+}
+
+// calcWork returns the amount of work a block with the given difficulty
+// bits represents, that is the expected number of hashes needed to find
+// a hash below its target: 2^256 / (target + 1).
+func calcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
@@ -0,0 +1,31 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCompactToBig is a function used to test
+// the conversion between compact bits and targets
+func TestCompactToBig(t *testing.T) {
+	expected, _ := new(big.Int).SetString("00000000ffff0000000000000000000000000000000000000000000000000000", 16)
+
+	assert.Equal(t, expected, CompactToBig(0x1d00ffff), "Target decoded from bits is correct")
+	assert.Equal(t, uint32(0x1d00ffff), BigToCompact(expected), "Bits encoded from target are correct")
+	assert.Equal(t, int64(0x12), CompactToBig(0x01120000).Int64(), "Small target decoded from bits is correct")
+	assert.Equal(t, uint32(0x02008000), BigToCompact(big.NewInt(0x80)), "Sign bit is not set")
+}
+
+// TestPowLimitBits is a function used to test
+// that the minimum difficulty round trips
+func TestPowLimitBits(t *testing.T) {
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNetParams, &chaincfg.RegressionNetParams} {
+		target := CompactToBig(params.PowLimitBits)
+
+		assert.True(t, target.Cmp(params.PowLimit) <= 0, "Genesis target does not exceed the limit")
+		assert.Equal(t, params.PowLimitBits, BigToCompact(target), "Genesis bits round trip")
+	}
+}
@@ -0,0 +1,164 @@
+package blockchain
+
+import "fmt"
+
+// ErrorCode identifies the consensus rule a block or transaction violates
+type ErrorCode int
+
+// These constants are used to identify a specific RuleError
+const (
+	// ErrMissingParent indicates the previous block of a block is unknown
+	ErrMissingParent ErrorCode = iota
+
+	// ErrDuplicateBlock indicates a block is already known
+	ErrDuplicateBlock
+
+	// ErrBadHeight indicates a block's height is not one more than its parent's
+	ErrBadHeight
+
+	// ErrUnexpectedDifficulty indicates a block's difficulty bits are not
+	// the ones the chain expects at its height
+	ErrUnexpectedDifficulty
+
+	// ErrHighHash indicates a block's hash does not satisfy its target
+	ErrHighHash
+
+	// ErrBadHash indicates a block's stored hash is not the hash of its header
+	ErrBadHash
+
+	// ErrBadMerkleRoot indicates the merkle root in a block's header
+	// does not match its transactions
+	ErrBadMerkleRoot
+
+	// ErrBadCheckpoint indicates a block at the height of a checkpoint
+	// is not the checkpoint block
+	ErrBadCheckpoint
+
+	// ErrForkTooOld indicates a block forks from the main chain below
+	// the latest checkpoint
+	ErrForkTooOld
+
+	// ErrTimeTooOld indicates a block's timestamp is not after the
+	// median timestamp of the previous blocks
+	ErrTimeTooOld
+
+	// ErrTimeTooNew indicates a block's timestamp is too far ahead
+	// of the network-adjusted time
+	ErrTimeTooNew
+
+	// ErrNoTransactions indicates a block has no transactions
+	ErrNoTransactions
+
+	// ErrBlockTooBig indicates a serialized block is larger than MaxBlockSize
+	ErrBlockTooBig
+
+	// ErrFirstTxNotCoinbase indicates the first transaction of a block is not a coinbase
+	ErrFirstTxNotCoinbase
+
+	// ErrMultipleCoinbases indicates a block has more than one coinbase
+	ErrMultipleCoinbases
+
+	// ErrBadCoinbaseValue indicates a coinbase pays more than it is allowed to
+	ErrBadCoinbaseValue
+
+	// ErrDuplicateTx indicates a block contains the same transaction twice
+	// or a transaction whose outputs are still unspent
+	ErrDuplicateTx
+
+	// ErrBadTxID indicates a transaction's ID is not the hash of its contents
+	ErrBadTxID
+
+	// ErrNoTxInputs indicates a transaction has no inputs
+	ErrNoTxInputs
+
+	// ErrNoTxOutputs indicates a transaction has no outputs
+	ErrNoTxOutputs
+
+	// ErrBadTxOutValue indicates a transaction output has a negative value
+	// or a value above MaxMoney, or the outputs or the inputs of a
+	// transaction are worth more than MaxMoney
+	ErrBadTxOutValue
+
+	// ErrDuplicateTxInputs indicates a transaction spends the same output twice
+	ErrDuplicateTxInputs
+
+	// ErrMissingTxOut indicates a transaction spends an output which
+	// does not exist or was already spent in the chain
+	ErrMissingTxOut
+
+	// ErrDoubleSpend indicates two transactions of a block spend the same output
+	ErrDoubleSpend
+
+	// ErrImmatureSpend indicates a transaction spends a coinbase output
+	// before CoinbaseMaturity blocks were built on top of it
+	ErrImmatureSpend
+
+	// ErrSpendTooHigh indicates a transaction's outputs are worth more than its inputs
+	ErrSpendTooHigh
+
+	// ErrBadSignature indicates a transaction input is not signed
+	// by the owner of the output it spends
+	ErrBadSignature
+
+	// ErrBadFees indicates the fees of a block, along with its
+	// subsidy, are worth more than MaxMoney
+	ErrBadFees
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing
+var errorCodeStrings = map[ErrorCode]string{
+	ErrMissingParent:        "ErrMissingParent",
+	ErrDuplicateBlock:       "ErrDuplicateBlock",
+	ErrBadHeight:            "ErrBadHeight",
+	ErrUnexpectedDifficulty: "ErrUnexpectedDifficulty",
+	ErrHighHash:             "ErrHighHash",
+	ErrBadHash:              "ErrBadHash",
+	ErrBadMerkleRoot:        "ErrBadMerkleRoot",
+	ErrBadCheckpoint:        "ErrBadCheckpoint",
+	ErrForkTooOld:           "ErrForkTooOld",
+	ErrTimeTooOld:           "ErrTimeTooOld",
+	ErrTimeTooNew:           "ErrTimeTooNew",
+	ErrNoTransactions:       "ErrNoTransactions",
+	ErrBlockTooBig:          "ErrBlockTooBig",
+	ErrFirstTxNotCoinbase:   "ErrFirstTxNotCoinbase",
+	ErrMultipleCoinbases:    "ErrMultipleCoinbases",
+	ErrBadCoinbaseValue:     "ErrBadCoinbaseValue",
+	ErrDuplicateTx:          "ErrDuplicateTx",
+	ErrBadTxID:              "ErrBadTxID",
+	ErrNoTxInputs:           "ErrNoTxInputs",
+	ErrNoTxOutputs:          "ErrNoTxOutputs",
+	ErrBadTxOutValue:        "ErrBadTxOutValue",
+	ErrDuplicateTxInputs:    "ErrDuplicateTxInputs",
+	ErrMissingTxOut:         "ErrMissingTxOut",
+	ErrDoubleSpend:          "ErrDoubleSpend",
+	ErrImmatureSpend:        "ErrImmatureSpend",
+	ErrSpendTooHigh:         "ErrSpendTooHigh",
+	ErrBadSignature:         "ErrBadSignature",
+	ErrBadFees:              "ErrBadFees",
+}
+
+// String returns the ErrorCode as a human-readable name
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// RuleError identifies a violation of the consensus rules,
+// the ErrorCode tells which rule was violated
+type RuleError struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+// ruleError creates a RuleError given a set of arguments
+func ruleError(c ErrorCode, desc string) RuleError {
+	return RuleError{ErrorCode: c, Description: desc}
+}
@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// ErrGenerateNotSupported is returned when generating blocks on a
+// network whose parameters do not allow it
+var ErrGenerateNotSupported = errors.New("block generation is not supported on this network")
+
+// GenerateToAddress mines n blocks on top of the tip one after the other,
+// paying their rewards to addr, and returns their hashes. Every block
+// includes the mempool transactions it can hold. The blocks are searched
+// for on a single worker and their coinbases are told apart by their
+// height rather than by random data, so the same chain, mempool and
+// clock always produce the same blocks.
+func (m *ChainManager) GenerateToAddress(n int, addr string) ([][]byte, error) {
+	if !m.Chain.params.GenerateSupported {
+		return nil, ErrGenerateNotSupported
+	}
+
+	var hashes [][]byte
+	for i := 0; i < n; i++ {
+		template, err := m.NewBlockTemplate()
+		if err != nil {
+			return hashes, err
+		}
+
+		coinbase := transaction.NewCoinbaseTX(addr, fmt.Sprintf("height %d", template.Height), template.CoinbaseValue)
+		txs := append([]*transaction.Transaction{coinbase}, template.Transactions...)
+
+		block, _, err := m.Chain.MineBlockContext(context.Background(), txs, 1)
+		if err != nil {
+			return hashes, err
+		}
+		log.Printf("Generated block %x at height %d", block.Hash, block.Height)
+
+		hashes = append(hashes, block.Hash)
+	}
+
+	return hashes, nil
+}
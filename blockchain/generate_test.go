@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGenerateToAddress checks generated blocks pay the given address
+// and that the same clock always produces the same chain
+func TestGenerateToAddress(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+	mockTime := time.Unix(params.GenesisTimestamp+600, 0)
+
+	generate := func() (*ChainManager, [][]byte) {
+		chain, err := CreateBlockchainWithDB(database.NewMemory(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock := NewMockClock()
+		clock.SetMockTime(mockTime)
+		chainMgr := NewChainManager(chain, nil)
+		chainMgr.SetTimeSource(NewMedianTime(clock))
+
+		hashes, err := chainMgr.GenerateToAddress(5, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return chainMgr, hashes
+	}
+
+	chainMgr, hashes := generate()
+	_, again := generate()
+	assert.Equal(t, hashes, again, "Same clock generates the same blocks")
+
+	if assert.Len(t, hashes, 5) {
+		assert.Equal(t, hashes[4], chainMgr.Chain.Tip)
+	}
+	for i, hash := range hashes {
+		block, err := chainMgr.Chain.GetBlock(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, i+1, block.Height)
+		assert.True(t, block.Timestamp >= mockTime.Unix(), "Timestamp follows the mock clock")
+		assert.True(t, block.Transactions[0].Vout[0].IsLockedWithKey(address.HashPubKey(a.PublicKey)), "Reward goes to the address")
+	}
+
+	mainChain, err := CreateBlockchainWithDB(database.NewMemory(), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewChainManager(mainChain, nil).GenerateToAddress(1, addr)
+	assert.Equal(t, ErrGenerateNotSupported, err)
+}
@@ -1,19 +1,91 @@
 package blockchain
 
-import "github.com/murlokito/gophercoin/transaction"
+import (
+	"github.com/murlokito/gophercoin/transaction"
+)
 
-type TransactionPool map[string]transaction.Transaction
+// TxSource is the pool of transactions waiting to be mined, implemented
+// by the mempool. The ChainManager passes it the notifications of the
+// chain to keep it in sync with the main chain.
+type TxSource interface {
+	// MiningTxs returns the transactions of the pool
+	MiningTxs() []*transaction.Transaction
+
+	// HandleNotification updates the pool for a change of the main chain
+	HandleNotification(n *Notification)
+}
 
 type ChainManager struct {
 	Chain   *Blockchain
-	MemPool TransactionPool
 	UTXOSet *UTXOSet
+
+	// TxSource provides the transactions of the blocks
+	// built on top of the chain, nil when there is none
+	TxSource TxSource
+
+	// TimeSource gathers the time offsets of the peers, it is
+	// shared with the chain to check the timestamps of blocks
+	TimeSource MedianTimeSource
 }
 
 func NewChainManager(chain *Blockchain, set *UTXOSet) *ChainManager {
-	return &ChainManager{
-		Chain:   chain,
-		UTXOSet: set,
-		MemPool: make(TransactionPool, 0),
+	m := &ChainManager{
+		Chain:      chain,
+		UTXOSet:    set,
+		TimeSource: NewMedianTime(SystemClock),
+	}
+
+	if chain != nil {
+		chain.SetTimeSource(m.TimeSource)
+		chain.Subscribe(m.handleNotification)
 	}
+
+	return m
+}
+
+// SetChain replaces the chain managed by the ChainManager,
+// used when the chain is only created after startup
+func (m *ChainManager) SetChain(chain *Blockchain) {
+	m.Chain = chain
+	m.UTXOSet = &UTXOSet{
+		Chain: chain,
+	}
+
+	chain.SetTimeSource(m.TimeSource)
+	chain.Subscribe(m.handleNotification)
+}
+
+// SetTimeSource replaces the source of the network-adjusted
+// time of the ChainManager and of its chain
+func (m *ChainManager) SetTimeSource(timeSource MedianTimeSource) {
+	m.TimeSource = timeSource
+	if m.Chain != nil {
+		m.Chain.SetTimeSource(timeSource)
+	}
+}
+
+// handleNotification passes the notifications of the chain to the
+// source of transactions, to keep it in sync with the main chain
+func (m *ChainManager) handleNotification(n *Notification) {
+	if m.TxSource != nil {
+		m.TxSource.HandleNotification(n)
+	}
+}
+
+// SelectTransactions returns the transactions of the mempool to include
+// in a block on top of the tip: the valid ones paying the highest fee
+// rates which fit in a block, each following the mempool transactions it
+// spends outputs of. The ones left out stay in the mempool.
+func (m *ChainManager) SelectTransactions() []*transaction.Transaction {
+	if m.TxSource == nil {
+		return nil
+	}
+
+	return m.Chain.SelectTransactions(m.TxSource.MiningTxs(), MaxBlockSize-coinbaseReserveSize)
+}
+
+// NewBlockTemplate returns the template of a block on top of the tip
+// including the transactions selected from the mempool
+func (m *ChainManager) NewBlockTemplate() (*BlockTemplate, error) {
+	return m.Chain.NewBlockTemplate(m.SelectTransactions())
 }
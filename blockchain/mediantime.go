@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of the current time, injected so
+// tests do not depend on the time they run at
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock reading the time of the system
+type systemClock struct{}
+
+// Now returns the current time of the system
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock reading the time of the system
+var SystemClock Clock = systemClock{}
+
+// MockClock is a Clock reading the time of the system unless a mock
+// time is set, letting tests and the regression test network control
+// the timestamps of the blocks
+type MockClock struct {
+	mutex    sync.Mutex
+	mockTime time.Time
+}
+
+// NewMockClock creates a MockClock reading the time of the system
+func NewMockClock() *MockClock {
+	return &MockClock{}
+}
+
+// Now returns the mock time if it is set, the time of the system otherwise
+func (c *MockClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.mockTime.IsZero() {
+		return time.Now()
+	}
+
+	return c.mockTime
+}
+
+// SetMockTime sets the time returned by the clock,
+// the zero time going back to the time of the system
+func (c *MockClock) SetMockTime(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.mockTime = t
+}
+
+// MedianTimeSource provides the network-adjusted time: the time of the
+// local clock corrected by the median of the offsets between the local
+// clock and the clocks of the peers
+type MedianTimeSource interface {
+	// AdjustedTime returns the current time corrected by the offset
+	AdjustedTime() time.Time
+
+	// AddTimeSample adds the time reported by a peer, identified
+	// by id, only the first sample of every peer is used
+	AddTimeSample(id string, timeVal time.Time)
+
+	// Offset returns the offset applied to the local clock
+	Offset() time.Duration
+}
+
+// medianTime is the MedianTimeSource used by the chain
+type medianTime struct {
+	mutex    sync.Mutex
+	clock    Clock
+	knownIDs map[string]struct{}
+	offsets  []int64
+	offset   int64
+}
+
+// NewMedianTime creates a MedianTimeSource over the given clock,
+// with no offset until enough peers have reported their time
+func NewMedianTime(clock Clock) MedianTimeSource {
+	return &medianTime{
+		clock:    clock,
+		knownIDs: make(map[string]struct{}),
+	}
+}
+
+// AdjustedTime returns the current time corrected by the offset
+func (m *medianTime) AdjustedTime() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Unix(m.clock.Now().Unix(), 0)
+	return now.Add(time.Duration(m.offset) * time.Second)
+}
+
+// AddTimeSample adds the time reported by a peer. The offset is the
+// median of the offsets of the last maxTimeSamples peers once there are
+// at least minTimeSamples of them, unless it is larger than
+// maxAllowedTimeOffset in which case the local clock is trusted.
+func (m *medianTime) AddTimeSample(id string, timeVal time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, exists := m.knownIDs[id]; exists {
+		return
+	}
+	m.knownIDs[id] = struct{}{}
+
+	if len(m.offsets) == maxTimeSamples {
+		m.offsets = m.offsets[1:]
+	}
+	offset := timeVal.Unix() - m.clock.Now().Unix()
+	m.offsets = append(m.offsets, offset)
+
+	if len(m.offsets) < minTimeSamples {
+		return
+	}
+
+	sorted := make([]int64, len(m.offsets))
+	copy(sorted, m.offsets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+
+	if median < -int64(maxAllowedTimeOffset/time.Second) || median > int64(maxAllowedTimeOffset/time.Second) {
+		median = 0
+	}
+	m.offset = median
+}
+
+// Offset returns the offset applied to the local clock
+func (m *medianTime) Offset() time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return time.Duration(m.offset) * time.Second
+}
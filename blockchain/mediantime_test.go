@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedClock is a Clock stuck at a given time
+type fixedClock struct {
+	now time.Time
+}
+
+// Now returns the time the clock is stuck at
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+// TestMedianTime checks the offset is the median of the peer samples
+// once there are enough of them and only when it is not too large
+func TestMedianTime(t *testing.T) {
+	clock := &fixedClock{now: time.Unix(1557266400, 0)}
+	ts := NewMedianTime(clock)
+
+	offsets := []time.Duration{-10, 20, 40, 30, 10}
+	for i, offset := range offsets {
+		assert.Equal(t, time.Duration(0), ts.Offset(), "Not enough samples")
+		ts.AddTimeSample(fmt.Sprint(i), clock.now.Add(offset*time.Second))
+	}
+	assert.Equal(t, 20*time.Second, ts.Offset())
+	assert.Equal(t, clock.now.Add(20*time.Second), ts.AdjustedTime())
+
+	ts.AddTimeSample("0", clock.now.Add(time.Hour))
+	assert.Equal(t, 20*time.Second, ts.Offset(), "Only the first sample of a peer is used")
+
+	for i := 0; i < 6; i++ {
+		ts.AddTimeSample(fmt.Sprint("far", i), clock.now.Add(2*time.Hour))
+	}
+	assert.Equal(t, time.Duration(0), ts.Offset(), "Offsets above the limit are ignored")
+}
+
+// TestBlockTimestamps checks a block's timestamp must be after the median
+// time of the previous blocks and not too far ahead of the adjusted time
+func TestBlockTimestamps(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+	clock := &fixedClock{now: time.Unix(params.GenesisTimestamp, 0).Add(24 * time.Hour)}
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.SetTimeSource(NewMedianTime(clock))
+
+	// Blocks mined faster than the clock moves get increasing timestamps
+	prev := genesisBlock(params)
+	for height := 1; height <= medianTimeBlocks; height++ {
+		coinbase := transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(height, params))
+		prev, err = bc.MineBlock([]*transaction.Transaction{coinbase})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.True(t, prev.Timestamp > clock.now.Unix(), "Timestamp moved past the median time")
+
+	next := func(timestamp int64) error {
+		coinbase := transaction.NewCoinbaseTX(addr, fmt.Sprint(timestamp), CalcBlockSubsidy(prev.Height+1, params))
+		block := NewBlock(prev.Hash, []*transaction.Transaction{coinbase}, prev.Height+1, params.PowLimitBits, timestamp)
+		return bc.AddBlock(block)
+	}
+
+	err = next(clock.now.Unix())
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrTimeTooOld, err.(RuleError).ErrorCode, "Timestamp at the median time is rejected")
+	}
+
+	err = next(clock.now.Add(maxTimeOffset).Unix() + 1)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrTimeTooNew, err.(RuleError).ErrorCode, "Timestamp too far ahead is rejected")
+	}
+
+	assert.NoError(t, next(clock.now.Add(maxTimeOffset).Unix()))
+}
@@ -1,12 +1,19 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 )
 
 // MerkleTree represent a Merkle tree
 type MerkleTree struct {
 	RootNode *MerkleNode
+
+	// levels holds the nodes of every level from the leaves up
+	// to the root, odd levels padded with their last node
+	levels [][]*MerkleNode
+	leaves int
 }
 
 // MerkleNode represent a Merkle tree node
@@ -16,31 +23,46 @@ type MerkleNode struct {
 	Data  []byte
 }
 
-// NewMerkleTree creates a new Merkle tree from a sequence of data
+// MerkleProof proves a leaf is part of a Merkle tree: hashing the
+// leaf with the hashes of its siblings from the bottom level up
+// gives the root. The bits of the index of the leaf tell on which
+// side of the sibling the hash goes at each level.
+type MerkleProof struct {
+	Index  int
+	Hashes [][]byte
+}
+
+// NewMerkleTree creates a new Merkle tree from a sequence of data.
+// The last node of every level with an odd number of nodes is
+// paired with itself.
 func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode
+	var nodes []*MerkleNode
 
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return &MerkleTree{RootNode: &MerkleNode{Data: make([]byte, sha256.Size)}}
 	}
 
 	for _, dat := range data {
-		node := NewMerkleNode(nil, nil, dat)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewMerkleNode(nil, nil, dat))
 	}
 
-	for i := 0; i < len(data)/2; i++ {
-		var newLevel []MerkleNode
+	var levels [][]*MerkleNode
+	for len(nodes) > 1 {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		levels = append(levels, nodes)
 
+		var newLevel []*MerkleNode
 		for j := 0; j < len(nodes); j += 2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			newLevel = append(newLevel, *node)
+			newLevel = append(newLevel, NewMerkleNode(nodes[j], nodes[j+1], nil))
 		}
 
 		nodes = newLevel
 	}
+	levels = append(levels, nodes)
 
-	mTree := MerkleTree{&nodes[0]}
+	mTree := MerkleTree{RootNode: nodes[0], levels: levels, leaves: len(data)}
 
 	return &mTree
 }
@@ -53,9 +75,7 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 		hash := sha256.Sum256(data)
 		merkleNode.Data = hash[:]
 	} else {
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		merkleNode.Data = hash[:]
+		merkleNode.Data = hashNodes(left.Data, right.Data)
 	}
 
 	merkleNode.Left = left
@@ -63,3 +83,50 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 
 	return &merkleNode
 }
+
+// hashNodes returns the hash of a node with the given children hashes
+func hashNodes(left, right []byte) []byte {
+	prevHashes := make([]byte, 0, len(left)+len(right))
+	prevHashes = append(prevHashes, left...)
+	prevHashes = append(prevHashes, right...)
+	hash := sha256.Sum256(prevHashes)
+
+	return hash[:]
+}
+
+// Proof returns the proof that the leaf at the given index is part of the tree
+func (t *MerkleTree) Proof(index int) (*MerkleProof, error) {
+	if index < 0 || index >= t.leaves {
+		return nil, errors.New("leaf index out of range")
+	}
+
+	proof := &MerkleProof{Index: index}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		proof.Hashes = append(proof.Hashes, level[index^1].Data)
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyMerkleProof returns whether the proof shows the leaf data,
+// the ID of a transaction for the tree of a block, is part of the
+// tree with the given root
+func VerifyMerkleProof(root, data []byte, proof *MerkleProof) bool {
+	if proof == nil || proof.Index < 0 {
+		return false
+	}
+
+	hash := NewMerkleNode(nil, nil, data).Data
+	index := proof.Index
+	for _, sibling := range proof.Hashes {
+		if index%2 == 0 {
+			hash = hashNodes(hash, sibling)
+		} else {
+			hash = hashNodes(sibling, hash)
+		}
+		index /= 2
+	}
+
+	return index == 0 && bytes.Equal(hash, root)
+}
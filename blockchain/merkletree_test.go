@@ -80,3 +80,54 @@ func TestNewMerkleTree(t *testing.T) {
 
 	assert.Equal(t, rootHash, fmt.Sprintf("%x", mTree.RootNode.Data), "Merkle tree root hash is correct")
 }
+
+// TestMerkleTreeOddLevels checks the last node is duplicated at every
+// level with an odd number of nodes, not only at the bottom one
+func TestMerkleTreeOddLevels(t *testing.T) {
+	var data [][]byte
+	var leaves []*MerkleNode
+	for i := 0; i < 6; i++ {
+		data = append(data, []byte(fmt.Sprint("node", i)))
+		leaves = append(leaves, NewMerkleNode(nil, nil, data[i]))
+	}
+
+	// Level 2 has three nodes, the last one is paired with itself
+	n01 := NewMerkleNode(leaves[0], leaves[1], nil)
+	n23 := NewMerkleNode(leaves[2], leaves[3], nil)
+	n45 := NewMerkleNode(leaves[4], leaves[5], nil)
+	root := NewMerkleNode(NewMerkleNode(n01, n23, nil), NewMerkleNode(n45, n45, nil), nil)
+
+	assert.Equal(t, root.Data, NewMerkleTree(data).RootNode.Data, "Merkle tree root hash is correct")
+	assert.Equal(t, leaves[0].Data, NewMerkleTree(data[:1]).RootNode.Data, "Single leaf is the root")
+}
+
+// TestMerkleProof checks the proof of every leaf of trees of
+// various sizes verifies, and only against its own leaf and root
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		var data [][]byte
+		for i := 0; i < size; i++ {
+			data = append(data, []byte(fmt.Sprint("tx", i)))
+		}
+		tree := NewMerkleTree(data)
+		root := tree.RootNode.Data
+
+		for i := range data {
+			proof, err := tree.Proof(i)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.True(t, VerifyMerkleProof(root, data[i], proof), "Proof of leaf %d of %d verifies", i, size)
+			assert.False(t, VerifyMerkleProof(root, []byte("other"), proof), "Proof does not verify another leaf")
+
+			// The last leaf of an odd level is its own sibling
+			if i^1 < size {
+				moved := &MerkleProof{Index: i ^ 1, Hashes: proof.Hashes}
+				assert.False(t, VerifyMerkleProof(root, data[i], moved), "Proof does not verify at another index")
+			}
+		}
+
+		_, err := tree.Proof(size)
+		assert.Error(t, err, "Index past the leaves is rejected")
+	}
+}
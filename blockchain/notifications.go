@@ -0,0 +1,58 @@
+package blockchain
+
+// NotificationType represents the type of a notification
+// sent by the Blockchain
+type NotificationType int
+
+// Types of notifications sent by the Blockchain
+const (
+	// NTBlockConnected is sent when a block is connected to the main chain
+	NTBlockConnected NotificationType = iota
+	// NTBlockDisconnected is sent when a block is disconnected
+	// from the main chain during a reorganization
+	NTBlockDisconnected
+)
+
+// String returns a human-readable representation of a NotificationType
+func (n NotificationType) String() string {
+	switch n {
+	case NTBlockConnected:
+		return "BlockConnected"
+	case NTBlockDisconnected:
+		return "BlockDisconnected"
+	}
+
+	return "Unknown"
+}
+
+// Notification defines a notification sent to subscribers of the Blockchain
+type Notification struct {
+	Type  NotificationType
+	Block *Block
+}
+
+// NotificationCallback is the function subscribers of the
+// Blockchain use to receive notifications
+type NotificationCallback func(*Notification)
+
+// Subscribe registers a callback to receive notifications about
+// changes to the main chain. Callbacks run after the change is
+// committed and without the Blockchain lock held.
+func (bc *Blockchain) Subscribe(callback NotificationCallback) {
+	bc.notificationsMutex.Lock()
+	defer bc.notificationsMutex.Unlock()
+
+	bc.notifications = append(bc.notifications, callback)
+}
+
+// sendNotifications delivers the notifications to all subscribers
+func (bc *Blockchain) sendNotifications(notifications []*Notification) {
+	bc.notificationsMutex.RLock()
+	defer bc.notificationsMutex.RUnlock()
+
+	for _, n := range notifications {
+		for _, callback := range bc.notifications {
+			callback(n)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+)
+
+// orphanBlock is a block whose parent is not known yet,
+// waiting in the orphan pool for the parent to arrive
+type orphanBlock struct {
+	block      *Block
+	expiration time.Time
+}
+
+// IsKnownOrphan returns whether the block with the
+// given hash is waiting in the orphan pool
+func (bc *Blockchain) IsKnownOrphan(hash []byte) bool {
+	bc.orphanMutex.Lock()
+	defer bc.orphanMutex.Unlock()
+
+	_, exists := bc.orphans[hex.EncodeToString(hash)]
+	return exists
+}
+
+// MissingAncestor returns the hash of the block which must be fetched
+// to start connecting the orphan with the given hash, that is the
+// parent of the oldest orphan in its ancestry.
+func (bc *Blockchain) MissingAncestor(hash []byte) []byte {
+	bc.orphanMutex.Lock()
+	defer bc.orphanMutex.Unlock()
+
+	missing := hash
+	orphan, exists := bc.orphans[hex.EncodeToString(hash)]
+	for exists {
+		missing = orphan.block.PrevBlockHash
+		orphan, exists = bc.orphans[hex.EncodeToString(missing)]
+	}
+
+	return missing
+}
+
+// removeOrphanBlock removes the orphan from the pool.
+// The orphan lock must be held.
+func (bc *Blockchain) removeOrphanBlock(orphan *orphanBlock) {
+	hash := hex.EncodeToString(orphan.block.Hash)
+	delete(bc.orphans, hash)
+
+	prevHash := hex.EncodeToString(orphan.block.PrevBlockHash)
+	siblings := bc.prevOrphans[prevHash]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(bc.prevOrphans, prevHash)
+	} else {
+		bc.prevOrphans[prevHash] = siblings
+	}
+}
+
+// addOrphanBlock adds the block to the orphan pool. Expired orphans are
+// evicted first and, if the pool is still full, the orphan closest to
+// expiring is evicted to make room.
+func (bc *Blockchain) addOrphanBlock(block *Block) {
+	bc.orphanMutex.Lock()
+	defer bc.orphanMutex.Unlock()
+
+	now := time.Now()
+	for _, orphan := range bc.orphans {
+		if now.After(orphan.expiration) {
+			bc.removeOrphanBlock(orphan)
+		}
+	}
+
+	if len(bc.orphans)+1 > maxOrphanBlocks {
+		var oldest *orphanBlock
+		for _, orphan := range bc.orphans {
+			if oldest == nil || orphan.expiration.Before(oldest.expiration) {
+				oldest = orphan
+			}
+		}
+		bc.removeOrphanBlock(oldest)
+	}
+
+	orphan := &orphanBlock{
+		block:      block,
+		expiration: now.Add(orphanExpiration),
+	}
+	bc.orphans[hex.EncodeToString(block.Hash)] = orphan
+
+	prevHash := hex.EncodeToString(block.PrevBlockHash)
+	bc.prevOrphans[prevHash] = append(bc.prevOrphans[prevHash], orphan)
+}
+
+// processOrphans adds to the chain the orphans which were waiting for
+// the block with the given hash, and then recursively the orphans
+// waiting for those.
+func (bc *Blockchain) processOrphans(hash []byte) {
+	queue := [][]byte{hash}
+
+	for len(queue) > 0 {
+		parentHash := queue[0]
+		queue = queue[1:]
+
+		bc.orphanMutex.Lock()
+		children := append([]*orphanBlock{}, bc.prevOrphans[hex.EncodeToString(parentHash)]...)
+		for _, orphan := range children {
+			bc.removeOrphanBlock(orphan)
+		}
+		bc.orphanMutex.Unlock()
+
+		for _, orphan := range children {
+			err := bc.AddBlock(orphan.block)
+			if err != nil {
+				log.Printf("Rejected orphan block %x: %v", orphan.block.Hash, err)
+				continue
+			}
+
+			queue = append(queue, orphan.block.Hash)
+		}
+	}
+}
+
+// ProcessBlock is the entry point for blocks received from the network.
+// Blocks whose parent is unknown are kept in the orphan pool and the
+// returned bool is true, once they pass the checks which do not need
+// the parent. Otherwise the block is added to the chain and any orphans
+// waiting for it are connected too.
+func (bc *Blockchain) ProcessBlock(block *Block) (bool, error) {
+	if bc.HaveBlock(block.Hash) || bc.IsKnownOrphan(block.Hash) {
+		return false, nil
+	}
+
+	if len(block.PrevBlockHash) != 0 && !bc.HaveBlock(block.PrevBlockHash) {
+		// Blocks without proof of work must not evict real orphans
+		bc.mutex.RLock()
+		timeSource := bc.timeSource
+		bc.mutex.RUnlock()
+
+		err := CheckBlock(block, bc.params, timeSource, BFNone)
+		if err != nil {
+			return false, err
+		}
+
+		log.Printf("Adding orphan block %x with parent %x", block.Hash, block.PrevBlockHash)
+		bc.addOrphanBlock(block)
+
+		// The parent may have been connected since it was looked up,
+		// its orphans processed before this one was added
+		if bc.HaveBlock(block.PrevBlockHash) {
+			bc.processOrphans(block.PrevBlockHash)
+			return bc.IsKnownOrphan(block.Hash), nil
+		}
+
+		return true, nil
+	}
+
+	err := bc.AddBlock(block)
+	if err != nil {
+		return false, err
+	}
+
+	bc.processOrphans(block.Hash)
+
+	return false, nil
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProcessOrphans checks blocks received before their parent wait in
+// the orphan pool and are connected once the parent arrives, while
+// blocks failing the checks are kept out of the pool
+func TestProcessOrphans(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := sideBranch(params, addr, 3, func(height int) int {
+		return CalcBlockSubsidy(height, params)
+	})
+
+	for _, block := range []*Block{blocks[2], blocks[1]} {
+		orphan, err := bc.ProcessBlock(block)
+		assert.NoError(t, err)
+		assert.True(t, orphan)
+		assert.True(t, bc.IsKnownOrphan(block.Hash))
+	}
+	assert.Equal(t, blocks[0].Hash, bc.MissingAncestor(blocks[2].Hash))
+
+	// A block whose hash does not match its header is rejected
+	junk := *blocks[2]
+	junk.Hash = make([]byte, 32)
+	_, _ = rand.Read(junk.Hash)
+	_, err = bc.ProcessBlock(&junk)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadHash, err.(RuleError).ErrorCode)
+	}
+	assert.False(t, bc.IsKnownOrphan(junk.Hash), "Invalid block is not kept as an orphan")
+
+	orphan, err := bc.ProcessBlock(blocks[0])
+	assert.NoError(t, err)
+	assert.False(t, orphan)
+	assert.Equal(t, blocks[2].Hash, bc.Tip, "Orphans are connected once their parent arrives")
+	assert.False(t, bc.IsKnownOrphan(blocks[1].Hash))
+	assert.False(t, bc.IsKnownOrphan(blocks[2].Hash))
+}
+
+// TestOrphanEviction checks the orphan closest to expiring is evicted
+// once the orphan pool is full
+func TestOrphanEviction(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := genesisBlock(params)
+
+	var orphans []*Block
+	for i := 0; i <= maxOrphanBlocks; i++ {
+		parent := make([]byte, 32)
+		_, _ = rand.Read(parent)
+		coinbase := transaction.NewCoinbaseTX(addr, fmt.Sprintf("orphan %d", i), CalcBlockSubsidy(2, params))
+		block := NewBlock(parent, []*transaction.Transaction{coinbase}, 2, params.PowLimitBits, genesis.Timestamp+2)
+
+		orphan, err := bc.ProcessBlock(block)
+		assert.NoError(t, err)
+		assert.True(t, orphan)
+		orphans = append(orphans, block)
+	}
+
+	assert.Len(t, bc.orphans, maxOrphanBlocks)
+	assert.False(t, bc.IsKnownOrphan(orphans[0].Hash), "Oldest orphan is evicted")
+	assert.True(t, bc.IsKnownOrphan(orphans[1].Hash))
+	assert.True(t, bc.IsKnownOrphan(orphans[maxOrphanBlocks].Hash))
+}
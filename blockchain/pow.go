@@ -1,75 +1,207 @@
 package blockchain
 
 import (
-	"bytes"
+	"context"
 	"crypto/sha256"
-	"log"
+	"encoding/binary"
+	"errors"
 	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// errNonceSpaceExhausted is returned when no nonce gives a hash
+// of the header below the target
+var errNonceSpaceExhausted = errors.New("nonce space exhausted")
+
 // ProofOfWork is a mechanism used in blockchains.
 // The main ideia is that some hard work has to be
 // done to add a block to the blockchain.
 // This helps maintain the stability of the
 // blockchain database.
 type ProofOfWork struct {
-	block  *Block
+	header *BlockHeader
 	target *big.Int
 }
 
-// func that merges the block fields with the target and counter
-// this "prepared" the data to be hashed
-func (pow *ProofOfWork) prepareData(counter int) []byte {
-
-	data := bytes.Join(
-		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			IntToHex(pow.block.Timestamp),
-			IntToHex(int64(targetBits)),
-			IntToHex(int64(counter)),
-		},
-		[]byte{},
-	)
-	return data
+// func that returns the header with the given nonce
+// in its binary form, this "prepares" the data to be hashed
+func (pow *ProofOfWork) prepareData(nonce uint32) []byte {
+	header := *pow.header
+	header.Nonce = nonce
+
+	return header.Serialize()
 }
 
-// basic proof of work function which will
-// enable us to mine blocks
-func (pow *ProofOfWork) run() (int, []byte) {
-
-	var hashInt big.Int // hash represented in integer form
-	var hash [32]byte
-	counter := 0
-
-	log.Printf("[POW] Mining block containing \n%v\n", pow.block.Transactions)
-
-	for counter < maxNonce {
-		data := pow.prepareData(counter)
-		hash = sha256.Sum256(data)
-		hashInt.SetBytes(hash[:])
-		log.Printf("[POW-DEBUG] HASH: %v", hash)
-		if hashInt.Cmp(pow.target) == -1 {
-			break
-		} else {
-			counter++
-		}
+// MiningStats reports the work done searching for a block
+type MiningStats struct {
+	Hashes  uint64
+	Elapsed time.Duration
+}
+
+// HashRate returns the number of hashes computed per second
+func (s MiningStats) HashRate() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Hashes) / s.Elapsed.Seconds()
+}
+
+// solve searches for a nonce giving a hash of the header below the
+// target. The nonce space is split across the given number of workers,
+// worker i trying the nonces i, i + workers, i + 2 * workers and so on,
+// so a single worker always finds the lowest nonce. It returns the
+// nonce, the hash and the number of hashes computed, along with
+// errNonceSpaceExhausted if there is no such nonce or the error of
+// the context if it is done first.
+func (pow *ProofOfWork) solve(ctx context.Context, workers int) (uint32, []byte, uint64, error) {
+	type solution struct {
+		nonce uint32
+		hash  []byte
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var hashes uint64
+	var wg sync.WaitGroup
+	found := make(chan solution, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start uint64) {
+			defer wg.Done()
+			var hashInt big.Int
+			var done uint64
+
+			for nonce := start; nonce <= uint64(maxNonce); nonce += uint64(workers) {
+				if done%hashCheckInterval == 0 {
+					atomic.AddUint64(&hashes, done)
+					done = 0
+					if ctx.Err() != nil {
+						return
+					}
+				}
+
+				hash := sha256.Sum256(pow.prepareData(uint32(nonce)))
+				done++
+				hashInt.SetBytes(hash[:])
+				if hashInt.Cmp(pow.target) == -1 {
+					atomic.AddUint64(&hashes, done)
+					found <- solution{uint32(nonce), hash[:]}
+					cancel()
+					return
+				}
+			}
+			atomic.AddUint64(&hashes, done)
+		}(uint64(i))
+	}
+
+	wg.Wait()
+	close(found)
+
+	// With several workers the first solution found is kept,
+	// whichever nonce it has
+	if s, ok := <-found; ok {
+		return s.nonce, s.hash, hashes, nil
+	}
+
+	// The search is only cancelled here once a solution is found,
+	// without one the context is done because its parent is
+	if err := ctx.Err(); err != nil {
+		return 0, nil, hashes, err
+	}
+
+	return 0, nil, hashes, errNonceSpaceExhausted
+}
+
+// setExtraNonce sets the extra nonce held in the last 8 bytes of
+// the coinbase data, giving the block a new merkle root and so a new
+// nonce space. The bytes are appended the first time.
+func (b *Block) setExtraNonce(extraNonce uint64) error {
+	if len(b.Transactions) == 0 || !b.Transactions[0].IsCoinbase() {
+		return errors.New("block has no coinbase to hold an extra nonce")
+	}
+
+	coinbase := b.Transactions[0]
+	data := coinbase.Vin[0].PubKey
+	if extraNonce > 1 {
+		data = data[:len(data)-8]
 	}
 
-	log.Printf("[POW] Block hash found: %v \n", hash)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], extraNonce)
+	coinbase.Vin[0].PubKey = append(append([]byte{}, data...), buf[:]...)
+	coinbase.ID = coinbase.Hash()
+	b.MerkleRoot = b.HashTransactions()
 
-	return counter, hash[:]
+	return nil
+}
+
+// Solve mines the block, searching for its nonce with the given number
+// of workers. When the nonce space runs out the timestamp is moved to the
+// time of the time source if it is ahead, otherwise the extra nonce of the
+// coinbase is bumped, and the search starts again. The search stops with
+// the error of the context if it is done first, a new tip making the
+// block stale for instance.
+func (b *Block) Solve(ctx context.Context, workers int, timeSource MedianTimeSource) (MiningStats, error) {
+	var stats MiningStats
+	var extraNonce uint64
+	start := time.Now()
+
+	for {
+		nonce, hash, hashes, err := NewProofOfWork(&b.BlockHeader).solve(ctx, workers)
+		stats.Hashes += hashes
+		stats.Elapsed = time.Since(start)
+		if err == nil {
+			b.Nonce = nonce
+			b.Hash = hash
+			return stats, nil
+		}
+		if err != errNonceSpaceExhausted {
+			return stats, err
+		}
+
+		if timeSource != nil && timeSource.AdjustedTime().Unix() > b.Timestamp {
+			b.Timestamp = timeSource.AdjustedTime().Unix()
+			continue
+		}
+
+		extraNonce++
+		err = b.setExtraNonce(extraNonce)
+		if err != nil {
+			return stats, err
+		}
+	}
 }
 
 // Validate is the func that decides whether the proof of work
-// is valid of not
-func (pow *ProofOfWork) Validate() bool {
+// is valid of not. The header must carry the difficulty bits the
+// chain expects at its height and its hash must meet that target.
+func (pow *ProofOfWork) Validate(bc *Blockchain) bool {
+	bits, err := bc.CalcNextRequiredBits(pow.header.PrevBlockHash)
+	if err != nil {
+		return false
+	}
 
+	return pow.validate(bits)
+}
+
+// validate checks the proof of work against the given expected bits
+func (pow *ProofOfWork) validate(expectedBits uint32) bool {
 	var hashInt big.Int
 
-	data := pow.prepareData(pow.block.Nonce)
-	hash := sha256.Sum256(data)
-	hashInt.SetBytes(hash[:])
+	if pow.header.Bits != expectedBits {
+		return false
+	}
+
+	hashInt.SetBytes(pow.header.Hash())
 	isValid := hashInt.Cmp(pow.target) == -1
 
 	return isValid
@@ -84,10 +216,10 @@ func (pow *ProofOfWork) Validate() bool {
 // is lower than the boundary it's valid.
 // Lowering the boundary makes if more
 // difficult to find a valid hash.
-func NewProofOfWork(b *Block) *ProofOfWork {
+// The target is decoded from the header's difficulty bits.
+func NewProofOfWork(h *BlockHeader) *ProofOfWork {
 
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
-	POW := &ProofOfWork{b, target}
+	target := CompactToBig(h.Bits)
+	POW := &ProofOfWork{h, target}
 	return POW
 }
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAddress returns a new address to pay coinbases to
+func testAddress() string {
+	return string(address.NewAddress().GetAddress(0x00))
+}
+
+// TestSolveWorkers checks the nonce found by several workers
+// gives a hash of the header below the target
+func TestSolveWorkers(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTX(testAddress(), "solve", 10)
+	block := newBlockTemplate([]byte{}, []*transaction.Transaction{coinbase}, 0, 0x1f00ffff, 1557266400)
+
+	stats, err := block.Solve(context.Background(), 4, nil)
+	assert.NoError(t, err)
+	assert.True(t, stats.Hashes > 0, "Hashes are counted")
+	assert.Equal(t, block.BlockHeader.Hash(), block.Hash)
+	assert.True(t, NewProofOfWork(&block.BlockHeader).validate(0x1f00ffff), "Hash meets the target")
+}
+
+// TestSolveCancel checks a search which can not succeed
+// stops once its context is done
+func TestSolveCancel(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTX(testAddress(), "cancel", 10)
+	block := newBlockTemplate([]byte{}, []*transaction.Transaction{coinbase}, 0, 0x03000001, 1557266400)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := block.Solve(ctx, 2, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+// TestSetExtraNonce checks bumping the extra nonce changes the
+// coinbase and the merkle root but keeps the coinbase data
+func TestSetExtraNonce(t *testing.T) {
+	coinbase := transaction.NewCoinbaseTX(testAddress(), "extra", 10)
+	block := newBlockTemplate([]byte{}, []*transaction.Transaction{coinbase}, 0, 0x207fffff, 1557266400)
+	root := block.MerkleRoot
+
+	assert.NoError(t, block.setExtraNonce(1))
+	assert.NotEqual(t, root, block.MerkleRoot)
+	root = block.MerkleRoot
+
+	assert.NoError(t, block.setExtraNonce(2))
+	assert.NotEqual(t, root, block.MerkleRoot)
+	assert.True(t, bytes.HasPrefix(coinbase.Vin[0].PubKey, []byte("extra")))
+	assert.Len(t, coinbase.Vin[0].PubKey, len("extra")+8)
+	assert.Equal(t, coinbase.Hash(), coinbase.ID)
+	assert.NoError(t, CheckTransactionSanity(coinbase))
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// CalcBlockSubsidy returns the amount the coinbase of the block at the
+// given height can claim on top of the fees of the block. It starts at
+// the base subsidy of the network and is halved every
+// SubsidyHalvingInterval blocks, until it drops to zero.
+func CalcBlockSubsidy(height int, params *chaincfg.Params) int {
+	if params.SubsidyHalvingInterval == 0 {
+		return params.BaseSubsidy
+	}
+
+	halvings := uint(height / params.SubsidyHalvingInterval)
+	if halvings >= 63 {
+		return 0
+	}
+
+	return params.BaseSubsidy >> halvings
+}
+
+// utxoEntry is an unspent output along with the height of the block
+// which created it and whether it was created by a coinbase
+type utxoEntry struct {
+	output   transaction.TXOutput
+	height   int
+	coinbase bool
+}
+
+// isMature returns whether the output can be spent in
+// the block at the given height
+func (e utxoEntry) isMature(spendHeight, maturity int) bool {
+	return !e.coinbase || spendHeight-e.height >= maturity
+}
+
+// addCreatedOutputs adds the outputs of the transaction, included
+// in the block at the given height, to the created entries
+func addCreatedOutputs(created map[string]utxoEntry, tx *transaction.Transaction, height int) {
+	for outIdx, out := range tx.Vout {
+		created[outpointKey(tx.ID, outIdx)] = utxoEntry{
+			output:   out,
+			height:   height,
+			coinbase: tx.IsCoinbase(),
+		}
+	}
+}
+
+// lookupOutput returns the output spent by the input, looking first at
+// the outputs created by the transactions before it in the same block
+// and then at the UTXO set
+func lookupOutput(utxo database.Bucket, created map[string]utxoEntry, vin transaction.TXInput) (utxoEntry, bool) {
+	entry, ok := created[outpointKey(vin.Txid, vin.Vout)]
+	if ok {
+		return entry, true
+	}
+
+	outsBytes := utxo.Get(vin.Txid)
+	if outsBytes == nil {
+		return entry, false
+	}
+
+	outs := transaction.DeserializeOutputs(outsBytes)
+	entry.output, ok = outs.Outputs[vin.Vout]
+	entry.height = outs.Height
+	entry.coinbase = outs.Coinbase
+
+	return entry, ok
+}
+
+// calcFees returns the fees of the transactions of a block at the given
+// height, the value of their inputs minus the value of their outputs.
+// Inputs may spend outputs created by earlier transactions of the block.
+// Like when validating the block, every sum is bounded by MaxMoney.
+func calcFees(utxo database.Bucket, transactions []*transaction.Transaction, height int) (int, error) {
+	var fees int
+	created := make(map[string]utxoEntry)
+
+	for _, t := range transactions {
+		if !t.IsCoinbase() {
+			valueIn, valueOut := 0, 0
+			for _, vin := range t.Vin {
+				entry, ok := lookupOutput(utxo, created, vin)
+				if !ok {
+					return 0, ruleError(ErrMissingTxOut, fmt.Sprintf("transaction %x spends unknown or spent output %s", t.ID, outpointKey(vin.Txid, vin.Vout)))
+				}
+
+				valueIn, ok = addValue(valueIn, entry.output.Value)
+				if !ok {
+					return 0, ruleError(ErrBadTxOutValue, fmt.Sprintf("inputs of transaction %x are worth more than the maximum of %d", t.ID, MaxMoney))
+				}
+			}
+			for _, out := range t.Vout {
+				var ok bool
+				valueOut, ok = addValue(valueOut, out.Value)
+				if !ok {
+					return 0, ruleError(ErrBadTxOutValue, fmt.Sprintf("outputs of transaction %x are worth more than the maximum of %d", t.ID, MaxMoney))
+				}
+			}
+			if valueOut > valueIn {
+				return 0, ruleError(ErrSpendTooHigh, fmt.Sprintf("transaction %x spends %d but its inputs are worth %d", t.ID, valueOut, valueIn))
+			}
+
+			var ok bool
+			fees, ok = addValue(fees, valueIn-valueOut)
+			if !ok {
+				return 0, ruleError(ErrBadFees, fmt.Sprintf("fees of the transactions are worth more than the maximum of %d", MaxMoney))
+			}
+		}
+
+		addCreatedOutputs(created, t, height)
+	}
+
+	return fees, nil
+}
+
+// calcCoinbaseValue returns the subsidy at the given height plus the
+// fees, failing when they are worth more than MaxMoney
+func calcCoinbaseValue(height, fees int, params *chaincfg.Params) (int, error) {
+	value, ok := addValue(CalcBlockSubsidy(height, params), fees)
+	if !ok {
+		return 0, ruleError(ErrBadFees, fmt.Sprintf("subsidy and fees are worth more than the maximum of %d", MaxMoney))
+	}
+
+	return value, nil
+}
+
+// CalcCoinbaseValue returns the amount the coinbase of a block built on
+// top of the tip with the given transactions can claim: the subsidy at
+// its height plus the fees of the transactions, the value of their
+// inputs minus the value of their outputs.
+func (bc *Blockchain) CalcCoinbaseValue(transactions []*transaction.Transaction) (int, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var fees, height int
+
+	err := bc.db.View(func(tx database.Tx) error {
+		tip, err := fetchBlock(tx.Bucket([]byte(blocksBucket)), bc.Tip)
+		if err != nil {
+			return err
+		}
+		height = tip.Height + 1
+
+		fees, err = calcFees(tx.Bucket([]byte(utxoBucket)), transactions, height)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return calcCoinbaseValue(height, fees, bc.params)
+}
@@ -0,0 +1,233 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCalcBlockSubsidy checks the subsidy is halved
+// every SubsidyHalvingInterval blocks
+func TestCalcBlockSubsidy(t *testing.T) {
+	params := chaincfg.Params{BaseSubsidy: 50, SubsidyHalvingInterval: 10}
+
+	assert.Equal(t, 50, CalcBlockSubsidy(0, &params))
+	assert.Equal(t, 50, CalcBlockSubsidy(9, &params))
+	assert.Equal(t, 25, CalcBlockSubsidy(10, &params))
+	assert.Equal(t, 12, CalcBlockSubsidy(20, &params))
+	assert.Equal(t, 0, CalcBlockSubsidy(60, &params))
+	assert.Equal(t, 0, CalcBlockSubsidy(10000, &params))
+
+	params.SubsidyHalvingInterval = 0
+	assert.Equal(t, 50, CalcBlockSubsidy(10000, &params), "Subsidy is never halved")
+}
+
+// TestCoinbaseFees checks a coinbase can claim the fees
+// of its block but not a single unit more
+func TestCoinbaseFees(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	funding, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spend the funding coinbase leaving a fee of 3
+	prev := funding.Transactions[0]
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}},
+		Vout: []transaction.TXOutput{{Value: prev.Vout[0].Value - 3, PubKeyHash: address.HashPubKey(a.PublicKey)}},
+	}
+	tx.ID = tx.Hash()
+	prevTXs, err := bc.FindPreviousTransactions(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, tx.Sign(a.PrivateKey, prevTXs))
+
+	value, err := bc.CalcCoinbaseValue([]*transaction.Transaction{tx})
+	assert.NoError(t, err)
+	assert.Equal(t, CalcBlockSubsidy(2, params)+3, value)
+
+	_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", value+1), tx})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCoinbaseValue, err.(RuleError).ErrorCode, "Coinbase overpaying is rejected")
+	}
+
+	_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", value), tx})
+	assert.NoError(t, err, "Coinbase claiming the fees is accepted")
+}
+
+// TestMaxMoney checks values above MaxMoney, on their own or summed up,
+// are rejected instead of wrapping around
+func TestMaxMoney(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+	pubKeyHash := address.HashPubKey(a.PublicKey)
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	funding, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// spend returns a transaction spending the funding coinbase to
+	// outputs of the given values
+	spend := func(values ...int) *transaction.Transaction {
+		prev := funding.Transactions[0]
+		tx := &transaction.Transaction{Vin: []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}}}
+		for _, value := range values {
+			tx.Vout = append(tx.Vout, transaction.TXOutput{Value: value, PubKeyHash: pubKeyHash})
+		}
+		tx.ID = tx.Hash()
+		assert.NoError(t, tx.Sign(a.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(prev.ID): *prev}))
+		return tx
+	}
+
+	for _, tx := range []*transaction.Transaction{spend(MaxMoney + 1), spend(MaxMoney, 1)} {
+		err := CheckTransactionSanity(tx)
+		if assert.Error(t, err) {
+			assert.Equal(t, ErrBadTxOutValue, err.(RuleError).ErrorCode)
+		}
+	}
+	assert.NoError(t, CheckTransactionSanity(spend(MaxMoney)))
+
+	// Outputs wrapping around to less than the inputs are rejected
+	overflow := spend(math.MaxInt64, math.MaxInt64)
+	_, err = bc.CheckTransactionInputs(overflow, nil)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadTxOutValue, err.(RuleError).ErrorCode)
+	}
+
+	// The value a coinbase can claim does not wrap around either
+	_, err = bc.CalcCoinbaseValue([]*transaction.Transaction{overflow})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadTxOutValue, err.(RuleError).ErrorCode)
+	}
+	_, err = bc.NewBlockTemplate([]*transaction.Transaction{overflow})
+	assert.Error(t, err)
+
+	block := NewBlock(funding.Hash, []*transaction.Transaction{
+		transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(2, params)+12),
+		overflow,
+	}, 2, params.PowLimitBits, funding.Timestamp+1)
+	err = bc.AddBlock(block)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadTxOutValue, err.(RuleError).ErrorCode, "Overflowing block is rejected")
+	}
+
+	// The totals are checked when connecting the block as well
+	err = bc.db.View(func(tx database.Tx) error {
+		return checkConnectBlock(params, tx.Bucket([]byte(utxoBucket)), block, BFNone)
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadTxOutValue, err.(RuleError).ErrorCode)
+	}
+
+	// A coinbase whose outputs wrap around is rejected
+	coinbase := &transaction.Transaction{
+		Vin: []transaction.TXInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("overflow")}},
+		Vout: []transaction.TXOutput{
+			{Value: math.MaxInt64, PubKeyHash: pubKeyHash},
+			{Value: math.MaxInt64, PubKeyHash: pubKeyHash},
+		},
+	}
+	coinbase.ID = coinbase.Hash()
+	block = NewBlock(funding.Hash, []*transaction.Transaction{coinbase}, 2, params.PowLimitBits, funding.Timestamp+1)
+	err = bc.db.View(func(tx database.Tx) error {
+		return checkConnectBlock(params, tx.Bucket([]byte(utxoBucket)), block, BFNone)
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCoinbaseValue, err.(RuleError).ErrorCode)
+	}
+	assert.Equal(t, funding.Hash, bc.Tip)
+}
+
+// TestCoinbaseMaturity checks a coinbase can only be spent once
+// CoinbaseMaturity blocks were built on top of it
+func TestCoinbaseMaturity(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 3
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxoSet := UTXOSet{Chain: bc}
+
+	funding, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := funding.Transactions[0]
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}},
+		Vout: []transaction.TXOutput{{Value: prev.Vout[0].Value, PubKeyHash: address.HashPubKey(a.PublicKey)}},
+	}
+	tx.ID = tx.Hash()
+	prevTXs, err := bc.FindPreviousTransactions(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, tx.Sign(a.PrivateKey, prevTXs))
+
+	pubKeyHash := address.HashPubKey(a.PublicKey)
+	for height := 2; height < 1+params.CoinbaseMaturity; height++ {
+		_, err = bc.CheckTransactionInputs(tx, nil)
+		if assert.Error(t, err) {
+			assert.Equal(t, ErrImmatureSpend, err.(RuleError).ErrorCode, "Immature spend is not admitted")
+		}
+
+		_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(height, params)), tx})
+		if assert.Error(t, err) {
+			assert.Equal(t, ErrImmatureSpend, err.(RuleError).ErrorCode, "Immature spend is rejected")
+		}
+
+		_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(height, params))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the funding coinbase has matured by now
+	spendable, immature := utxoSet.GetBalance(pubKeyHash)
+	assert.Equal(t, prev.Vout[0].Value, spendable)
+	assert.Equal(t, (params.CoinbaseMaturity-1)*params.BaseSubsidy, immature)
+
+	acc, outputs := utxoSet.FindSpendableOutputs(pubKeyHash, 1000)
+	assert.Equal(t, prev.Vout[0].Value, acc)
+	assert.Equal(t, map[string][]int{hex.EncodeToString(prev.ID): {0}}, outputs)
+
+	fee, err := bc.CheckTransactionInputs(tx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, fee)
+
+	_, err = bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(1+params.CoinbaseMaturity, params)), tx})
+	assert.NoError(t, err, "Mature spend is accepted")
+}
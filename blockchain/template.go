@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// BlockTemplate holds what a miner needs to build a block on top of
+// the tip: the header fields, the transactions to include besides the
+// coinbase and the value the coinbase can claim. A miner running in
+// another process builds the coinbase, solves the block and hands it
+// back to the node with SubmitBlock.
+type BlockTemplate struct {
+	Version       int32
+	PrevBlockHash []byte
+	Height        int
+	Bits          uint32
+	Target        *big.Int
+
+	// Timestamp is the suggested timestamp of the block, the
+	// network-adjusted time unless the chain is ahead of it
+	Timestamp int64
+
+	// MinTimestamp is the lowest timestamp the block can have,
+	// one second after the median time of the previous blocks
+	MinTimestamp int64
+
+	// Transactions are the transactions of the block, which
+	// follow the coinbase
+	Transactions []*transaction.Transaction
+
+	// CoinbaseValue is the subsidy at the height of the block
+	// plus the fees of the transactions
+	CoinbaseValue int
+}
+
+// nextBlockTiming returns the difficulty bits the block after prev must
+// carry, the timestamp it should have and the lowest timestamp it can
+// have. The suggested timestamp is the network-adjusted time unless the
+// median time of the previous blocks is ahead of it, when blocks come
+// fast.
+func nextBlockTiming(params *chaincfg.Params, b database.Bucket, prev *Block, timeSource MedianTimeSource) (uint32, int64, int64, error) {
+	bits, err := calcNextRequiredBits(params, b, prev)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	medianTime, err := calcPastMedianTime(b, prev)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	minTimestamp := medianTime + 1
+	timestamp := timeSource.AdjustedTime().Unix()
+	if timestamp < minTimestamp {
+		timestamp = minTimestamp
+	}
+
+	return bits, timestamp, minTimestamp, nil
+}
+
+// NewBlockTemplate returns the template of a block on top of the tip
+// including the given transactions, which must not hold a coinbase.
+// The transactions are expected to be valid, an error is returned if
+// one of them spends an unknown output.
+func (bc *Blockchain) NewBlockTemplate(transactions []*transaction.Transaction) (*BlockTemplate, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	template := &BlockTemplate{
+		Version:      blockVersion,
+		Transactions: transactions,
+	}
+
+	err := bc.db.View(func(tx database.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		tip, err := fetchBlock(b, fetchTipHash(b))
+		if err != nil {
+			return err
+		}
+		template.PrevBlockHash = tip.Hash
+		template.Height = tip.Height + 1
+
+		template.Bits, template.Timestamp, template.MinTimestamp, err = nextBlockTiming(bc.params, b, tip, bc.timeSource)
+		if err != nil {
+			return err
+		}
+
+		fees, err := calcFees(tx.Bucket([]byte(utxoBucket)), transactions, template.Height)
+		if err != nil {
+			return err
+		}
+		template.CoinbaseValue, err = calcCoinbaseValue(template.Height, fees, bc.params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	template.Target = CompactToBig(template.Bits)
+
+	return template, nil
+}
+
+// Block returns the block of the template with the given coinbase
+// followed by the transactions of the template, not solved yet
+func (t *BlockTemplate) Block(coinbase *transaction.Transaction) *Block {
+	transactions := append([]*transaction.Transaction{coinbase}, t.Transactions...)
+
+	return newBlockTemplate(t.PrevBlockHash, transactions, t.Height, t.Bits, t.Timestamp)
+}
+
+// SubmitBlock adds a block solved outside of the node, built from a
+// template, to the chain. Unlike ProcessBlock the block is not kept
+// as an orphan when its parent is unknown, it is rejected as stale.
+func (bc *Blockchain) SubmitBlock(block *Block) error {
+	if bc.HaveBlock(block.Hash) || bc.IsKnownOrphan(block.Hash) {
+		return ruleError(ErrDuplicateBlock, fmt.Sprintf("block %x is already known", block.Hash))
+	}
+
+	err := bc.AddBlock(block)
+	if err != nil {
+		return err
+	}
+	log.Printf("Submitted block %x added at height %d", block.Hash, block.Height)
+
+	bc.processOrphans(block.Hash)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBlockTemplate checks a block built and solved from a template
+// is connected once submitted, and only once
+func TestBlockTemplate(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	addr := testAddress()
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := bc.NewBlockTemplate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, bc.Tip, template.PrevBlockHash)
+	assert.Equal(t, 1, template.Height)
+	assert.Equal(t, params.PowLimitBits, template.Bits)
+	assert.Equal(t, CompactToBig(params.PowLimitBits), template.Target)
+	assert.Equal(t, CalcBlockSubsidy(1, params), template.CoinbaseValue)
+	assert.True(t, template.Timestamp >= template.MinTimestamp)
+
+	// A coinbase claiming more than the template allows is rejected
+	greedy := template.Block(transaction.NewCoinbaseTX(addr, "", template.CoinbaseValue+1))
+	if _, err := greedy.Solve(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = bc.SubmitBlock(greedy)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrBadCoinbaseValue, err.(RuleError).ErrorCode)
+	}
+
+	// The block goes through its encoding, as it does when submitted
+	block := template.Block(transaction.NewCoinbaseTX(addr, "", template.CoinbaseValue))
+	if _, err := block.Solve(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := block.SerializeBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted, err := DeserializeBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, bc.SubmitBlock(submitted))
+	assert.Equal(t, block.Hash, bc.Tip)
+
+	err = bc.SubmitBlock(submitted)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrDuplicateBlock, err.(RuleError).ErrorCode, "Known block is rejected")
+	}
+
+	// A block on top of an unknown block is not kept as an orphan
+	stale := newBlockTemplate(make([]byte, 32), []*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", template.CoinbaseValue)},
+		2, params.PowLimitBits, template.Timestamp+1)
+	if _, err := stale.Solve(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	err = bc.SubmitBlock(stale)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrMissingParent, err.(RuleError).ErrorCode, "Block with unknown parent is rejected")
+	}
+	assert.False(t, bc.IsKnownOrphan(stale.Hash))
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/murlokito/gophercoin/wire"
+)
+
+// txLocationLen is the length of an entry of the transaction index,
+// the hash of the block followed by the position of the transaction
+const txLocationLen = wire.HashSize + 4
+
+// The transaction index is optional, when its bucket exists it is kept
+// up to date as blocks are connected and disconnected and it is used to
+// find transactions without walking the chain.
+
+// encodeTxLocation encodes the location of a transaction in the main chain
+func encodeTxLocation(blockHash []byte, pos int) []byte {
+	location := make([]byte, txLocationLen)
+	copy(location, blockHash)
+	binary.LittleEndian.PutUint32(location[wire.HashSize:], uint32(pos))
+	return location
+}
+
+// indexBlockTransactions adds the transactions of the block to the
+// transaction index, when there is one
+func indexBlockTransactions(tx database.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for pos, t := range block.Transactions {
+		err := b.Put(t.ID, encodeTxLocation(block.Hash, pos))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexBlockTransactions removes the transactions of the block
+// from the transaction index, when there is one
+func unindexBlockTransactions(tx database.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+
+	for _, t := range block.Transactions {
+		err := b.Delete(t.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchIndexedTransaction looks for a transaction in the transaction
+// index. The returned bool is false when there is no index, in which
+// case the chain must be searched instead.
+func fetchIndexedTransaction(tx database.Tx, ID []byte) (*transaction.Transaction, bool, error) {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil, false, nil
+	}
+
+	location := b.Get(ID)
+	if location == nil {
+		return nil, true, errors.New("transaction was not found")
+	}
+	if len(location) != txLocationLen {
+		return nil, true, errors.New("corrupt transaction index entry")
+	}
+
+	block, err := fetchBlock(tx.Bucket([]byte(blocksBucket)), location[:wire.HashSize])
+	if err != nil {
+		return nil, true, err
+	}
+
+	pos := int(binary.LittleEndian.Uint32(location[wire.HashSize:]))
+	if pos >= len(block.Transactions) || !bytes.Equal(block.Transactions[pos].ID, ID) {
+		return nil, true, errors.New("corrupt transaction index entry")
+	}
+
+	return block.Transactions[pos], true, nil
+}
+
+// HasTxIndex returns whether the transaction index is maintained
+func (bc *Blockchain) HasTxIndex() bool {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var exists bool
+
+	err := bc.db.View(func(tx database.Tx) error {
+		exists = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+
+	return exists
+}
+
+// BuildTxIndex builds the transaction index from the main chain,
+// replacing the existing one if any. From then on the index is kept
+// up to date as blocks are connected and disconnected.
+func (bc *Blockchain) BuildTxIndex() error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.db.Update(func(tx database.Tx) error {
+		if tx.Bucket([]byte(txIndexBucket)) != nil {
+			err := tx.DeleteBucket([]byte(txIndexBucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		heights := tx.Bucket([]byte(heightBucket))
+		if heights == nil {
+			return nil
+		}
+
+		c := heights.Cursor()
+		for k, hash := c.First(); k != nil; k, hash = c.Next() {
+			block, err := fetchBlock(blocks, hash)
+			if err != nil {
+				return err
+			}
+
+			err = indexBlockTransactions(tx, block)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DropTxIndex removes the transaction index, transactions
+// are then found by walking the chain
+func (bc *Blockchain) DropTxIndex() error {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	return bc.db.Update(func(tx database.Tx) error {
+		if tx.Bucket([]byte(txIndexBucket)) == nil {
+			return nil
+		}
+
+		return tx.DeleteBucket([]byte(txIndexBucket))
+	})
+}
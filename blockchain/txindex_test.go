@@ -0,0 +1,90 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTxIndex checks the transaction index built from the main chain
+// follows the blocks connected and disconnected afterwards
+func TestTxIndex(t *testing.T) {
+	a := address.NewAddress()
+	bc, params, main := reorgChain(t, a)
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	// indexed looks for the transaction in the index only
+	indexed := func(ID []byte) (*transaction.Transaction, error) {
+		var found *transaction.Transaction
+		err := bc.db.View(func(tx database.Tx) error {
+			var (
+				ok  bool
+				err error
+			)
+			found, ok, err = fetchIndexedTransaction(tx, ID)
+			assert.True(t, ok, "Index is used")
+			return err
+		})
+		return found, err
+	}
+
+	assert.False(t, bc.HasTxIndex())
+	assert.NoError(t, bc.BuildTxIndex())
+	assert.True(t, bc.HasTxIndex())
+
+	for _, block := range main {
+		for _, tx := range block.Transactions {
+			found, err := indexed(tx.ID)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tx.ID, found.ID)
+			}
+		}
+	}
+
+	_, err := indexed([]byte("unknown transaction"))
+	assert.Error(t, err)
+	_, err = bc.FindTransaction([]byte("unknown transaction"))
+	assert.Error(t, err)
+
+	// Blocks connected once the index is built are indexed
+	a3, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(3, params))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := indexed(a3.Transactions[0].ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, a3.Transactions[0].ID, found.ID)
+	}
+
+	// A reorganization swaps the transactions of the branches
+	side := sideBranch(params, addr, 4, func(height int) int {
+		return CalcBlockSubsidy(height, params)
+	})
+	for _, block := range side {
+		assert.NoError(t, bc.AddBlock(block))
+	}
+	assert.Equal(t, side[3].Hash, bc.Tip)
+
+	for _, block := range append(main, a3) {
+		for _, tx := range block.Transactions {
+			_, err := indexed(tx.ID)
+			assert.Error(t, err, "Transactions of disconnected blocks are removed")
+		}
+	}
+	for _, block := range side {
+		found, err := indexed(block.Transactions[0].ID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, block.Transactions[0].ID, found.ID)
+		}
+	}
+
+	// Without the index the chain is searched instead
+	assert.NoError(t, bc.DropTxIndex())
+	assert.False(t, bc.HasTxIndex())
+	tx, err := bc.FindTransaction(side[1].Transactions[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, side[1].Transactions[0].ID, tx.ID)
+}
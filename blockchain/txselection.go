@@ -0,0 +1,208 @@
+package blockchain
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/hex"
+	"log"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// txPrioItem is a transaction waiting to be included in a block
+type txPrioItem struct {
+	tx   *transaction.Transaction
+	fee  int
+	size int
+
+	// parents are the IDs of the transactions of the pool it
+	// spends outputs of which are not included yet
+	parents map[string]struct{}
+}
+
+// txPriorityQueue orders the transactions by fee rate, the fee paid
+// per byte, highest first. It implements heap.Interface.
+type txPriorityQueue []*txPrioItem
+
+// Len returns the number of transactions in the queue
+func (pq txPriorityQueue) Len() int {
+	return len(pq)
+}
+
+// Less returns whether the transaction at i pays a higher fee rate than
+// the one at j, ties are broken by ID to keep the order deterministic
+func (pq txPriorityQueue) Less(i, j int) bool {
+	rateI := int64(pq[i].fee) * int64(pq[j].size)
+	rateJ := int64(pq[j].fee) * int64(pq[i].size)
+	if rateI != rateJ {
+		return rateI > rateJ
+	}
+
+	return bytes.Compare(pq[i].tx.ID, pq[j].tx.ID) < 0
+}
+
+// Swap swaps the transactions at i and j
+func (pq txPriorityQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+// Push adds a transaction to the queue
+func (pq *txPriorityQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(*txPrioItem))
+}
+
+// Pop removes the last transaction of the queue
+func (pq *txPriorityQueue) Pop() interface{} {
+	old := *pq
+	item := old[len(old)-1]
+	*pq = old[:len(old)-1]
+
+	return item
+}
+
+// newTxPrioItem computes the fee and size of a transaction of the pool.
+// Its inputs either spend unspent outputs or outputs of transactions of
+// the pool, false is returned when an input spends neither.
+func newTxPrioItem(utxo database.Bucket, pool map[string]*transaction.Transaction, tx *transaction.Transaction) (*txPrioItem, bool) {
+	item := &txPrioItem{
+		tx:      tx,
+		size:    len(tx.Serialize()),
+		parents: make(map[string]struct{}),
+	}
+
+	for _, vin := range tx.Vin {
+		parentID := hex.EncodeToString(vin.Txid)
+		if parent, exists := pool[parentID]; exists {
+			if vin.Vout < 0 || vin.Vout >= len(parent.Vout) {
+				return nil, false
+			}
+			item.fee += parent.Vout[vin.Vout].Value
+			item.parents[parentID] = struct{}{}
+			continue
+		}
+
+		entry, ok := lookupOutput(utxo, nil, vin)
+		if !ok {
+			return nil, false
+		}
+		item.fee += entry.output.Value
+	}
+
+	for _, out := range tx.Vout {
+		item.fee -= out.Value
+	}
+
+	return item, true
+}
+
+// selectTransactions picks the transactions of the pool to include in a
+// block at the given height, highest fee rate first, until no more fit
+// in maxSize bytes. A transaction spending outputs of others of the pool
+// is only considered once they are all included, so it always follows
+// them. Invalid transactions, those conflicting with the ones included
+// and the ones depending on them are left out.
+func selectTransactions(params *chaincfg.Params, utxo database.Bucket, pool []*transaction.Transaction, height, maxSize int) []*transaction.Transaction {
+	inPool := make(map[string]*transaction.Transaction)
+	for _, tx := range pool {
+		inPool[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	queue := &txPriorityQueue{}
+	dependers := make(map[string][]*txPrioItem)
+	for _, tx := range pool {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		item, ok := newTxPrioItem(utxo, inPool, tx)
+		if !ok {
+			log.Printf("Leaving out transaction %x spending unknown outputs", tx.ID)
+			continue
+		}
+
+		if len(item.parents) == 0 {
+			heap.Push(queue, item)
+			continue
+		}
+		for parentID := range item.parents {
+			dependers[parentID] = append(dependers[parentID], item)
+		}
+	}
+
+	var selected []*transaction.Transaction
+	created := make(map[string]utxoEntry)
+	spent := make(map[string]bool)
+	size := 0
+
+Queue:
+	for queue.Len() > 0 {
+		item := heap.Pop(queue).(*txPrioItem)
+		tx := item.tx
+
+		if size+item.size > maxSize {
+			continue
+		}
+
+		if utxo.Get(tx.ID) != nil {
+			continue
+		}
+
+		for _, vin := range tx.Vin {
+			if spent[outpointKey(vin.Txid, vin.Vout)] {
+				continue Queue
+			}
+		}
+
+		_, err := checkTransactionInputs(params, utxo, created, tx, height, BFNone)
+		if err != nil {
+			log.Printf("Leaving out transaction %x: %v", tx.ID, err)
+			continue
+		}
+
+		for _, vin := range tx.Vin {
+			spent[outpointKey(vin.Txid, vin.Vout)] = true
+		}
+		addCreatedOutputs(created, tx, height)
+		size += item.size
+		selected = append(selected, tx)
+
+		// The transactions spending its outputs can now follow it
+		id := hex.EncodeToString(tx.ID)
+		for _, child := range dependers[id] {
+			delete(child.parents, id)
+			if len(child.parents) == 0 {
+				heap.Push(queue, child)
+			}
+		}
+	}
+
+	return selected
+}
+
+// SelectTransactions picks the transactions of the pool to include in a
+// block on top of the tip, ordered by fee rate with every transaction
+// following the ones it spends outputs of, until no more fit in maxSize
+// bytes. The transactions left out are not touched.
+func (bc *Blockchain) SelectTransactions(pool []*transaction.Transaction, maxSize int) []*transaction.Transaction {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var selected []*transaction.Transaction
+
+	err := bc.db.View(func(tx database.Tx) error {
+		tip, err := fetchBlock(tx.Bucket([]byte(blocksBucket)), bc.Tip)
+		if err != nil {
+			return err
+		}
+
+		selected = selectTransactions(bc.params, tx.Bucket([]byte(utxoBucket)), pool, tip.Height+1, maxSize)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error selecting transactions: %v", err)
+		return nil
+	}
+
+	return selected
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedSpend returns a transaction spending the first output of prev,
+// owned by a, and paying value back to a
+func signedSpend(t *testing.T, a *address.Address, prev *transaction.Transaction, value int) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}},
+		Vout: []transaction.TXOutput{{Value: value, PubKeyHash: address.HashPubKey(a.PublicKey)}},
+	}
+	tx.ID = tx.Hash()
+	err := tx.Sign(a.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(prev.ID): *prev})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// TestSelectTransactions checks transactions are selected by fee rate,
+// children after their parents, leaving out conflicts and the ones
+// which do not fit in the block
+func TestSelectTransactions(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var coinbases []*transaction.Transaction
+	for height := 1; height <= 2; height++ {
+		block, err := bc.MineBlock([]*transaction.Transaction{transaction.NewCoinbaseTX(addr, "", CalcBlockSubsidy(height, params))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbases = append(coinbases, block.Transactions[0])
+	}
+
+	value := coinbases[0].Vout[0].Value
+	low := signedSpend(t, a, coinbases[0], value-1)
+	high := signedSpend(t, a, coinbases[1], value-5)
+	conflict := signedSpend(t, a, coinbases[1], value-2)
+	child := signedSpend(t, a, low, value-9)
+	pool := []*transaction.Transaction{child, conflict, low, high}
+
+	selected := bc.SelectTransactions(pool, MaxBlockSize)
+	assert.Equal(t, []*transaction.Transaction{high, low, child}, selected,
+		"Highest fee rate first, child after its parent, conflict left out")
+
+	template, err := bc.NewBlockTemplate(selected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, CalcBlockSubsidy(3, params)+5+1+8, template.CoinbaseValue)
+
+	block := template.Block(transaction.NewCoinbaseTX(addr, "", template.CoinbaseValue))
+	assert.NoError(t, bc.ValidateBlock(block, BFNoPoWCheck), "Block of the selected transactions is valid")
+
+	// Without room for the parent its child is left out too
+	maxSize := len(high.Serialize()) + len(low.Serialize()) - 1
+	selected = bc.SelectTransactions(pool, maxSize)
+	assert.Equal(t, []*transaction.Transaction{high}, selected)
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/murlokito/gophercoin/wire"
+)
+
+// SpentOutput is an output spent by a block, along with the outpoint
+// it was referenced by, the height of the block which created it and
+// whether it was created by a coinbase
+type SpentOutput struct {
+	Txid     []byte
+	Vout     int
+	Output   transaction.TXOutput
+	Height   int
+	Coinbase bool
+}
+
+// BlockUndo holds the information needed to disconnect a block from
+// the UTXO set, the outputs it spent in the order they were spent
+type BlockUndo struct {
+	SpentOutputs []SpentOutput
+}
+
+// Serialize encodes the BlockUndo before insertion in BoltDB,
+// as a varint count followed by the outpoint, the output and
+// the creation height and coinbase flag of every spent output,
+// packed in a varint as in the UTXO set
+func (u *BlockUndo) Serialize() ([]byte, error) {
+	var buff bytes.Buffer
+
+	err := wire.WriteVarInt(&buff, uint64(len(u.SpentOutputs)))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spent := range u.SpentOutputs {
+		err = wire.WriteVarBytes(&buff, spent.Txid)
+		if err != nil {
+			return nil, err
+		}
+
+		err = wire.WriteUint32(&buff, uint32(spent.Vout))
+		if err != nil {
+			return nil, err
+		}
+
+		err = spent.Output.Encode(&buff)
+		if err != nil {
+			return nil, err
+		}
+
+		code := uint64(spent.Height) << 1
+		if spent.Coinbase {
+			code |= 1
+		}
+		err = wire.WriteVarInt(&buff, code)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buff.Bytes(), nil
+}
+
+// DeserializeBlockUndo decodes a BlockUndo read from BoltDB
+func DeserializeBlockUndo(data []byte) (*BlockUndo, error) {
+	r := bytes.NewReader(data)
+
+	count, err := wire.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every spent output takes more than one byte, which
+	// bounds the count by the length of the data
+	if count > uint64(len(data)) {
+		return nil, fmt.Errorf("undo data holds %d spent outputs in %d bytes", count, len(data))
+	}
+
+	undo := &BlockUndo{SpentOutputs: make([]SpentOutput, count)}
+	for i := range undo.SpentOutputs {
+		spent := &undo.SpentOutputs[i]
+
+		spent.Txid, err = wire.ReadVarBytes(r, wire.HashSize, "spent txid")
+		if err != nil {
+			return nil, err
+		}
+
+		vout, err := wire.ReadUint32(r)
+		if err != nil {
+			return nil, err
+		}
+		spent.Vout = int(vout)
+
+		err = spent.Output.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+
+		code, err := wire.ReadVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		if code>>1 > math.MaxInt32 {
+			return nil, fmt.Errorf("spent output height %d out of range", code>>1)
+		}
+		spent.Height = int(code >> 1)
+		spent.Coinbase = code&1 == 1
+	}
+
+	return undo, nil
+}
+
+// fetchBlockUndo loads the undo data of the block with the given hash,
+// every block of the main chain has some recorded when it is connected
+func fetchBlockUndo(tx database.Tx, hash []byte) (*BlockUndo, error) {
+	var data []byte
+	if b := tx.Bucket([]byte(undoBucket)); b != nil {
+		data = b.Get(hash)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("no undo data for block %x", hash)
+	}
+
+	return DeserializeBlockUndo(data)
+}
+
+// putBlockUndo stores the undo data of the block with the given hash
+func putBlockUndo(tx database.Tx, hash []byte, undo *BlockUndo) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(undoBucket))
+	if err != nil {
+		return err
+	}
+
+	data, err := undo.Serialize()
+	if err != nil {
+		return err
+	}
+
+	return b.Put(hash, data)
+}
+
+// deleteBlockUndo removes the undo data of the block with the given hash
+func deleteBlockUndo(tx database.Tx, hash []byte) error {
+	b := tx.Bucket([]byte(undoBucket))
+	if b == nil {
+		return nil
+	}
+
+	return b.Delete(hash)
+}
@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBlockUndo checks the undo data recorded when a block is connected
+// survives serialization and restores the outputs it spent once the
+// block is disconnected
+func TestBlockUndo(t *testing.T) {
+	a := address.NewAddress()
+	bc, _, main := reorgChain(t, a)
+	funding, spend := main[0].Transactions[0], main[1].Transactions[1]
+
+	var undo *BlockUndo
+	err := bc.db.View(func(tx database.Tx) error {
+		var err error
+		undo, err = fetchBlockUndo(tx, main[1].Hash)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []SpentOutput{{
+		Txid:     funding.ID,
+		Vout:     0,
+		Output:   funding.Vout[0],
+		Height:   1,
+		Coinbase: true,
+	}}, undo.SpentOutputs)
+
+	data, err := undo.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DeserializeBlockUndo(data)
+	assert.NoError(t, err)
+	assert.Equal(t, undo, decoded)
+
+	_, err = DeserializeBlockUndo(data[:len(data)-1])
+	assert.Error(t, err, "Truncated undo data is rejected")
+
+	err = bc.db.Update(func(tx database.Tx) error {
+		return bc.disconnectBlock(tx, main[1])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxoSet := &UTXOSet{Chain: bc}
+	assert.Equal(t, funding.Vout, utxoSet.FindUTXO(address.HashPubKey(a.PublicKey)), "Spent coinbase is restored")
+	err = bc.db.View(func(tx database.Tx) error {
+		utxo := tx.Bucket([]byte(utxoBucket))
+		assert.Nil(t, utxo.Get(spend.ID), "Outputs of the disconnected block are removed")
+		assert.Nil(t, utxo.Get(main[1].Transactions[0].ID))
+		assert.Equal(t, main[0].Hash, fetchTipHash(tx.Bucket([]byte(blocksBucket))))
+
+		_, err := fetchBlockUndo(tx, main[1].Hash)
+		assert.Error(t, err, "Undo data of the disconnected block is removed")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// A block without undo data can not be disconnected
+	err = bc.db.Update(func(tx database.Tx) error {
+		return deleteBlockUndo(tx, main[0].Hash)
+	})
+	assert.NoError(t, err)
+	err = bc.db.Update(func(tx database.Tx) error {
+		return bc.disconnectBlock(tx, main[0])
+	})
+	assert.Error(t, err)
+}
@@ -1,37 +1,41 @@
 package blockchain
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
 	"log"
-	"sync"
 
 	"github.com/murlokito/gophercoin/transaction"
 
-	"github.com/boltdb/bolt"
+	"github.com/murlokito/gophercoin/database"
 )
 
 // UTXOSet is the structure which implements the UTXOSet
 // A Set comprised of all the unspent transaction outputs
 type UTXOSet struct {
 	Chain *Blockchain
-	Mutex *sync.RWMutex
 }
 
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
+// FindSpendableOutputs finds and returns unspent outputs to reference
+// in inputs, leaving out the coinbase outputs which can not be spent
+// in the next block yet
 func (u *UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[string][]int) {
-	u.Mutex.RLock()
-	defer u.Mutex.RUnlock()
 	unspentOutputs := make(map[string][]int)
 	accumulated := 0
 	db := u.Chain.db
+	spendHeight := u.Chain.GetBestHeight() + 1
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			txID := hex.EncodeToString(k)
 			outs := transaction.DeserializeOutputs(v)
+			if !outs.IsMature(spendHeight, u.Chain.params.CoinbaseMaturity) {
+				continue
+			}
 
 			for outIdx, out := range outs.Outputs {
 				if out.IsLockedWithKey(pubkeyHash) && accumulated < amount {
@@ -52,12 +56,10 @@ func (u *UTXOSet) FindSpendableOutputs(pubkeyHash []byte, amount int) (int, map[
 
 // FindUTXO finds UTXO for a public key hash
 func (u *UTXOSet) FindUTXO(pubKeyHash []byte) []transaction.TXOutput {
-	u.Mutex.RLock()
-	defer u.Mutex.RUnlock()
 	db := u.Chain.db
 	var UTXOs []transaction.TXOutput
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
@@ -80,19 +82,31 @@ func (u *UTXOSet) FindUTXO(pubKeyHash []byte) []transaction.TXOutput {
 	return UTXOs
 }
 
-// CountTransactions returns the number of transactions in the UTXO set
-func (u *UTXOSet) CountTransactions() int {
-	u.Mutex.RLock()
-	defer u.Mutex.RUnlock()
+// GetBalance returns the value of the unspent outputs locked with the
+// public key hash, split between the spendable ones and the coinbase
+// outputs which can not be spent in the next block yet
+func (u *UTXOSet) GetBalance(pubKeyHash []byte) (spendable int, immature int) {
 	db := u.Chain.db
-	counter := 0
+	spendHeight := u.Chain.GetBestHeight() + 1
 
-	err := db.View(func(tx *bolt.Tx) error {
+	err := db.View(func(tx database.Tx) error {
 		b := tx.Bucket([]byte(utxoBucket))
 		c := b.Cursor()
 
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			counter++
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			outs := transaction.DeserializeOutputs(v)
+			mature := outs.IsMature(spendHeight, u.Chain.params.CoinbaseMaturity)
+
+			for _, out := range outs.Outputs {
+				if !out.IsLockedWithKey(pubKeyHash) {
+					continue
+				}
+				if mature {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
 		}
 
 		return nil
@@ -101,25 +115,20 @@ func (u *UTXOSet) CountTransactions() int {
 		log.Panic(err)
 	}
 
-	return counter
+	return spendable, immature
 }
 
-// Reindex rebuilds the UTXO set
-func (u *UTXOSet) Reindex() {
-	u.Mutex.Lock()
-	defer u.Mutex.Unlock()
+// CountTransactions returns the number of transactions in the UTXO set
+func (u *UTXOSet) CountTransactions() int {
 	db := u.Chain.db
-	bucketName := []byte(utxoBucket)
+	counter := 0
 
-	err := db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket(bucketName)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			log.Panic(err)
-		}
+	err := db.View(func(tx database.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
 
-		_, err = tx.CreateBucket(bucketName)
-		if err != nil {
-			log.Panic(err)
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			counter++
 		}
 
 		return nil
@@ -128,78 +137,115 @@ func (u *UTXOSet) Reindex() {
 		log.Panic(err)
 	}
 
-	UTXO := u.Chain.FindUTXO()
+	return counter
+}
 
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
+// connectTransactions spends the outputs referenced by the inputs
+// of the block's transactions and adds the outputs they create.
+// It fails if any input references an output which is not unspent.
+// The spent outputs are returned as the block's undo data.
+func connectTransactions(b database.Bucket, block *Block) (*BlockUndo, error) {
+	undo := &BlockUndo{}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false {
+			for _, vin := range tx.Vin {
+				outsBytes := b.Get(vin.Txid)
+				if outsBytes == nil {
+					return nil, fmt.Errorf("transaction %x spends unknown output %x:%d", tx.ID, vin.Txid, vin.Vout)
+				}
+				outs := transaction.DeserializeOutputs(outsBytes)
 
-		for txID, outs := range UTXO {
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				log.Panic(err)
+				out, ok := outs.Outputs[vin.Vout]
+				if !ok {
+					return nil, fmt.Errorf("transaction %x spends spent output %x:%d", tx.ID, vin.Txid, vin.Vout)
+				}
+				delete(outs.Outputs, vin.Vout)
+
+				undo.SpentOutputs = append(undo.SpentOutputs, SpentOutput{
+					Txid:     vin.Txid,
+					Vout:     vin.Vout,
+					Output:   out,
+					Height:   outs.Height,
+					Coinbase: outs.Coinbase,
+				})
+
+				if len(outs.Outputs) == 0 {
+					err := b.Delete(vin.Txid)
+					if err != nil {
+						return nil, err
+					}
+				} else {
+					err := b.Put(vin.Txid, outs.Serialize())
+					if err != nil {
+						return nil, err
+					}
+				}
 			}
+		}
 
-			err = b.Put(key, outs.Serialize())
-			if err != nil {
-				log.Panic(err)
-			}
+		newOutputs := transaction.NewTXOutputs()
+		newOutputs.Height = block.Height
+		newOutputs.Coinbase = tx.IsCoinbase()
+		for outIdx, out := range tx.Vout {
+			newOutputs.Outputs[outIdx] = out
 		}
 
-		return nil
-	})
+		err := b.Put(tx.ID, newOutputs.Serialize())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return undo, nil
 }
 
-// Update updates the UTXO set with transactions from the Block
-// The Block is considered to be the tip of a Chain
-func (u *UTXOSet) Update(block *Block) {
-	u.Mutex.Lock()
-	defer u.Mutex.Unlock()
-	db := u.Chain.db
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
+// disconnectTransactions reverts connectTransactions for the given block.
+// The outputs created by the block are removed and the outputs it spent
+// are restored from its undo data.
+func disconnectTransactions(b database.Bucket, block *Block, undo *BlockUndo) error {
+	// Spent outputs are restored in the reverse order they were
+	// spent, walking the undo data backwards alongside the inputs
+	spentIdx := len(undo.SpentOutputs)
 
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false {
-				for _, vin := range tx.Vin {
-					updatedOuts := transaction.TXOutputs{}
-					outsBytes := b.Get(vin.Txid)
-					outs := transaction.DeserializeOutputs(outsBytes)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != vin.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
 
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(vin.Txid)
-						if err != nil {
-							log.Panic(err)
-						}
-					} else {
-						err := b.Put(vin.Txid, updatedOuts.Serialize())
-						if err != nil {
-							log.Panic(err)
-						}
-					}
+		err := b.Delete(tx.ID)
+		if err != nil {
+			return err
+		}
 
-				}
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for j := len(tx.Vin) - 1; j >= 0; j-- {
+			vin := tx.Vin[j]
+
+			spentIdx--
+			if spentIdx < 0 {
+				return fmt.Errorf("undo data of block %x is too short", block.Hash)
+			}
+			spent := undo.SpentOutputs[spentIdx]
+			if !bytes.Equal(spent.Txid, vin.Txid) || spent.Vout != vin.Vout {
+				return fmt.Errorf("undo data of block %x does not match its inputs", block.Hash)
 			}
 
-			newOutputs := transaction.TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+			outs := transaction.NewTXOutputs()
+			outs.Height = spent.Height
+			outs.Coinbase = spent.Coinbase
+			if outsBytes := b.Get(vin.Txid); outsBytes != nil {
+				outs = transaction.DeserializeOutputs(outsBytes)
 			}
+			outs.Outputs[vin.Vout] = spent.Output
 
-			err := b.Put(tx.ID, newOutputs.Serialize())
+			err = b.Put(vin.Txid, outs.Serialize())
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 		}
-
-		return nil
-	})
-	if err != nil {
-		log.Panic(err)
 	}
+
+	return nil
 }
@@ -0,0 +1,386 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// BehaviorFlags is a bitmask defining tweaks to the normal
+// behavior when validating blocks
+type BehaviorFlags uint32
+
+const (
+	// BFNone is a convenience value to specify no flags
+	BFNone BehaviorFlags = 0
+
+	// BFNoPoWCheck skips the proof of work checks, used to
+	// validate block templates before they are mined
+	BFNoPoWCheck BehaviorFlags = 1 << iota
+
+	// BFNoSigCheck skips the signature checks, used to connect
+	// the ancestors of the assume-valid block
+	BFNoSigCheck
+)
+
+// outpointKey returns the key used to identify the output
+// with the given index of the transaction with the given ID
+func outpointKey(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
+
+// addValue returns the sum of the total and the value, false when the
+// value is negative or the sum is above MaxMoney
+func addValue(total, value int) (int, bool) {
+	if value < 0 || value > MaxMoney || total > MaxMoney-value {
+		return 0, false
+	}
+
+	return total + value, true
+}
+
+// CheckTransactionSanity performs the checks on a transaction
+// which do not depend on the state of the chain
+func CheckTransactionSanity(tx *transaction.Transaction) error {
+	if len(tx.Vin) == 0 {
+		return ruleError(ErrNoTxInputs, fmt.Sprintf("transaction %x has no inputs", tx.ID))
+	}
+
+	if len(tx.Vout) == 0 {
+		return ruleError(ErrNoTxOutputs, fmt.Sprintf("transaction %x has no outputs", tx.ID))
+	}
+
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return ruleError(ErrBadTxID, fmt.Sprintf("transaction %x has an ID which is not its hash", tx.ID))
+	}
+
+	valueOut := 0
+	for _, out := range tx.Vout {
+		if out.Value < 0 {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("transaction %x has an output with negative value %d", tx.ID, out.Value))
+		}
+		if out.Value > MaxMoney {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("transaction %x has an output of value %d, more than the maximum of %d",
+				tx.ID, out.Value, MaxMoney))
+		}
+
+		var ok bool
+		valueOut, ok = addValue(valueOut, out.Value)
+		if !ok {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("outputs of transaction %x are worth more than the maximum of %d", tx.ID, MaxMoney))
+		}
+	}
+
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	spent := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		key := outpointKey(vin.Txid, vin.Vout)
+		if spent[key] {
+			return ruleError(ErrDuplicateTxInputs, fmt.Sprintf("transaction %x spends %s twice", tx.ID, key))
+		}
+		spent[key] = true
+	}
+
+	return nil
+}
+
+// CheckBlock performs the checks on a block which do not depend on
+// the state of the chain: the proof of work against the block's own
+// target, the merkle root, the timestamp against the network-adjusted
+// time, the coinbase and transaction sanity, following the rules of
+// the given network.
+func CheckBlock(block *Block, params *chaincfg.Params, timeSource MedianTimeSource, flags BehaviorFlags) error {
+	if flags&BFNoPoWCheck != BFNoPoWCheck {
+		target := CompactToBig(block.Bits)
+		if target.Sign() <= 0 || target.Cmp(params.PowLimit) > 0 {
+			return ruleError(ErrUnexpectedDifficulty, fmt.Sprintf("block %x has a target out of range", block.Hash))
+		}
+
+		if !bytes.Equal(block.BlockHeader.Hash(), block.Hash) {
+			return ruleError(ErrBadHash, fmt.Sprintf("block %x does not hash to its header", block.Hash))
+		}
+
+		if !NewProofOfWork(&block.BlockHeader).validate(block.Bits) {
+			return ruleError(ErrHighHash, fmt.Sprintf("block %x has a hash above its target", block.Hash))
+		}
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, fmt.Sprintf("block %x has a merkle root which does not match its transactions", block.Hash))
+	}
+
+	maxTimestamp := timeSource.AdjustedTime().Add(maxTimeOffset).Unix()
+	if block.Timestamp > maxTimestamp {
+		return ruleError(ErrTimeTooNew, fmt.Sprintf("block %x has a timestamp too far in the future", block.Hash))
+	}
+
+	if len(block.Transactions) == 0 {
+		return ruleError(ErrNoTransactions, fmt.Sprintf("block %x has no transactions", block.Hash))
+	}
+
+	if size := block.SerializeSize(); size > MaxBlockSize {
+		return ruleError(ErrBlockTooBig, fmt.Sprintf("block %x is %d bytes, more than the maximum of %d", block.Hash, size, MaxBlockSize))
+	}
+
+	if !block.Transactions[0].IsCoinbase() {
+		return ruleError(ErrFirstTxNotCoinbase, fmt.Sprintf("first transaction of block %x is not a coinbase", block.Hash))
+	}
+
+	seen := make(map[string]bool)
+	for i, tx := range block.Transactions {
+		if i > 0 && tx.IsCoinbase() {
+			return ruleError(ErrMultipleCoinbases, fmt.Sprintf("block %x has more than one coinbase", block.Hash))
+		}
+
+		err := CheckTransactionSanity(tx)
+		if err != nil {
+			return err
+		}
+
+		txID := hex.EncodeToString(tx.ID)
+		if seen[txID] {
+			return ruleError(ErrDuplicateTx, fmt.Sprintf("block %x contains transaction %s twice", block.Hash, txID))
+		}
+		seen[txID] = true
+	}
+
+	return nil
+}
+
+// calcPastMedianTime returns the median timestamp of the block and the
+// medianTimeBlocks - 1 blocks before it, or of all of them when the
+// chain is shorter
+func calcPastMedianTime(b database.Bucket, block *Block) (int64, error) {
+	timestamps := make([]int64, 0, medianTimeBlocks)
+
+	for len(timestamps) < medianTimeBlocks {
+		timestamps = append(timestamps, block.Timestamp)
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+
+		var err error
+		block, err = fetchBlock(b, block.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+// checkBlockContext performs the checks which depend on the block's
+// position in the chain: the link to its parent, its height, its
+// difficulty and its timestamp, which must be after the median
+// timestamp of the previous blocks.
+func checkBlockContext(params *chaincfg.Params, b database.Bucket, block *Block, prev *Block) error {
+	if prev == nil {
+		return ruleError(ErrMissingParent, fmt.Sprintf("previous block %x of block %x not found", block.PrevBlockHash, block.Hash))
+	}
+
+	if block.Height != prev.Height+1 {
+		return ruleError(ErrBadHeight, fmt.Sprintf("block %x has height %d, expected %d", block.Hash, block.Height, prev.Height+1))
+	}
+
+	expectedBits, err := calcNextRequiredBits(params, b, prev)
+	if err != nil {
+		return err
+	}
+	if block.Bits != expectedBits {
+		return ruleError(ErrUnexpectedDifficulty, fmt.Sprintf("block %x has difficulty bits %08x, expected %08x", block.Hash, block.Bits, expectedBits))
+	}
+
+	medianTime, err := calcPastMedianTime(b, prev)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= medianTime {
+		return ruleError(ErrTimeTooOld, fmt.Sprintf("block %x has timestamp %d, not after the median time %d of the previous blocks",
+			block.Hash, block.Timestamp, medianTime))
+	}
+
+	return nil
+}
+
+// checkTransactionInputs checks the inputs of a transaction to be
+// included in the block at the given height: they must spend unspent
+// and mature outputs, be signed by the outputs' owners and be worth at
+// least the transaction's outputs. It returns the fee of the transaction.
+// Passing BFNoSigCheck skips the signature checks.
+func checkTransactionInputs(params *chaincfg.Params, utxo database.Bucket, created map[string]utxoEntry, tx *transaction.Transaction, height int, flags BehaviorFlags) (int, error) {
+	var prevOuts []transaction.TXOutput
+	valueIn := 0
+
+	for _, vin := range tx.Vin {
+		key := outpointKey(vin.Txid, vin.Vout)
+		entry, ok := lookupOutput(utxo, created, vin)
+		if !ok {
+			return 0, ruleError(ErrMissingTxOut, fmt.Sprintf("transaction %x spends unknown or spent output %s", tx.ID, key))
+		}
+		if !entry.isMature(height, params.CoinbaseMaturity) {
+			return 0, ruleError(ErrImmatureSpend, fmt.Sprintf("transaction %x spends coinbase output %s of height %d before maturity",
+				tx.ID, key, entry.height))
+		}
+
+		prevOuts = append(prevOuts, entry.output)
+		valueIn, ok = addValue(valueIn, entry.output.Value)
+		if !ok {
+			return 0, ruleError(ErrBadTxOutValue, fmt.Sprintf("inputs of transaction %x are worth more than the maximum of %d", tx.ID, MaxMoney))
+		}
+	}
+
+	valueOut := 0
+	for _, out := range tx.Vout {
+		var ok bool
+		valueOut, ok = addValue(valueOut, out.Value)
+		if !ok {
+			return 0, ruleError(ErrBadTxOutValue, fmt.Sprintf("outputs of transaction %x are worth more than the maximum of %d", tx.ID, MaxMoney))
+		}
+	}
+	if valueOut > valueIn {
+		return 0, ruleError(ErrSpendTooHigh, fmt.Sprintf("transaction %x spends %d but its inputs are worth %d", tx.ID, valueOut, valueIn))
+	}
+
+	if flags&BFNoSigCheck != BFNoSigCheck && !tx.VerifySignatures(prevOuts) {
+		return 0, ruleError(ErrBadSignature, fmt.Sprintf("transaction %x has an invalid signature", tx.ID))
+	}
+
+	return valueIn - valueOut, nil
+}
+
+// checkConnectBlock checks the block's transactions against the UTXO
+// set it is about to be connected to: every input must spend an unspent
+// and mature output only once across the block, be signed by the
+// output's owner, no transaction may spend more than its inputs are
+// worth and the coinbase may not claim more than the subsidy plus the fees.
+// Passing BFNoSigCheck skips the signature checks.
+func checkConnectBlock(params *chaincfg.Params, utxo database.Bucket, block *Block, flags BehaviorFlags) error {
+	created := make(map[string]utxoEntry)
+	spent := make(map[string]bool)
+	fees := 0
+
+	for _, tx := range block.Transactions {
+		if utxo.Get(tx.ID) != nil {
+			return ruleError(ErrDuplicateTx, fmt.Sprintf("transaction %x overwrites unspent outputs", tx.ID))
+		}
+
+		if !tx.IsCoinbase() {
+			for _, vin := range tx.Vin {
+				key := outpointKey(vin.Txid, vin.Vout)
+				if spent[key] {
+					return ruleError(ErrDoubleSpend, fmt.Sprintf("transaction %x double spends %s", tx.ID, key))
+				}
+				spent[key] = true
+			}
+
+			fee, err := checkTransactionInputs(params, utxo, created, tx, block.Height, flags)
+			if err != nil {
+				return err
+			}
+
+			var ok bool
+			fees, ok = addValue(fees, fee)
+			if !ok {
+				return ruleError(ErrBadFees, fmt.Sprintf("fees of block %x are worth more than the maximum of %d", block.Hash, MaxMoney))
+			}
+		}
+
+		addCreatedOutputs(created, tx, block.Height)
+	}
+
+	coinbaseValue := 0
+	for _, out := range block.Transactions[0].Vout {
+		var ok bool
+		coinbaseValue, ok = addValue(coinbaseValue, out.Value)
+		if !ok {
+			return ruleError(ErrBadCoinbaseValue, fmt.Sprintf("coinbase of block %x pays more than the maximum of %d", block.Hash, MaxMoney))
+		}
+	}
+	maxValue, ok := addValue(CalcBlockSubsidy(block.Height, params), fees)
+	if !ok {
+		return ruleError(ErrBadFees, fmt.Sprintf("subsidy and fees of block %x are worth more than the maximum of %d", block.Hash, MaxMoney))
+	}
+	if coinbaseValue > maxValue {
+		return ruleError(ErrBadCoinbaseValue, fmt.Sprintf("coinbase of block %x pays %d, more than the subsidy and fees of %d",
+			block.Hash, coinbaseValue, maxValue))
+	}
+
+	return nil
+}
+
+// CheckTransactionInputs checks the inputs of a transaction against the
+// UTXO set, as if it was included in the next block, before accepting it
+// in the mempool. Its inputs may also spend the outputs of the given
+// unconfirmed transactions, the mempool transactions it depends on.
+// It returns the fee of the transaction.
+func (bc *Blockchain) CheckTransactionInputs(tx *transaction.Transaction, unconfirmed []*transaction.Transaction) (int, error) {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+	var fee int
+
+	err := bc.db.View(func(dbTx database.Tx) error {
+		tip, err := fetchBlock(dbTx.Bucket([]byte(blocksBucket)), bc.Tip)
+		if err != nil {
+			return err
+		}
+		height := tip.Height + 1
+
+		created := make(map[string]utxoEntry)
+		for _, parent := range unconfirmed {
+			addCreatedOutputs(created, parent, height)
+		}
+
+		utxo := dbTx.Bucket([]byte(utxoBucket))
+		fee, err = checkTransactionInputs(bc.params, utxo, created, tx, height, BFNone)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return fee, nil
+}
+
+// ValidateBlock fully validates the block against the current state of
+// the chain without adding it. The transactions are only checked against
+// the UTXO set when the block extends the current tip.
+// Passing BFNoPoWCheck allows validating a block template before mining it.
+func (bc *Blockchain) ValidateBlock(block *Block, flags BehaviorFlags) error {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	err := CheckBlock(block, bc.params, bc.timeSource, flags)
+	if err != nil {
+		return err
+	}
+
+	return bc.db.View(func(tx database.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+
+		prev, err := fetchBlock(b, block.PrevBlockHash)
+		if err != nil {
+			prev = nil
+		}
+
+		err = checkBlockContext(bc.params, b, block, prev)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(block.PrevBlockHash, fetchTipHash(b)) {
+			return nil
+		}
+
+		return checkConnectBlock(bc.params, tx.Bucket([]byte(utxoBucket)), block, flags)
+	})
+}
@@ -0,0 +1,253 @@
+package chaincfg
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"github.com/murlokito/gophercoin/wire"
+)
+
+var (
+	// bigOne is 1 represented as a big.Int, defined here to
+	// avoid the overhead of creating it multiple times
+	bigOne = big.NewInt(1)
+
+	// mainPowLimit is the highest target a block can have on the
+	// main and test networks, 2^255 - 1
+	mainPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
+
+	// regressionPowLimit is the highest target a block can have
+	// on the regression test network, 2^255 - 1
+	regressionPowLimit = new(big.Int).Sub(new(big.Int).Lsh(bigOne, 255), bigOne)
+
+	// genesisPubKeyHash is the public key hash the genesis coinbase
+	// pays to. Nobody holds its key, so the reward can not be spent.
+	genesisPubKeyHash = make([]byte, 20)
+
+	// mainGenesisHash is the hash of the genesis block of the main network
+	mainGenesisHash = newHashFromStr("4e60cc6890512cef713cadb565499500adcb4b0a1aa90ac341926e9867f3c0bf")
+
+	// testGenesisHash is the hash of the genesis block of the test network
+	testGenesisHash = newHashFromStr("71d9ac71e3fb5864c0fea34cde3f7a329160af2da69e8878ae87274e9df09401")
+)
+
+// newHashFromStr converts the hex string of a hash to bytes. It
+// is only used for the hardcoded hashes, so it panics on error.
+func newHashFromStr(hexStr string) []byte {
+	hash, err := hex.DecodeString(hexStr)
+	if err != nil {
+		panic(err)
+	}
+
+	return hash
+}
+
+// Checkpoint identifies a known good block of the main chain
+type Checkpoint struct {
+	Height int
+	Hash   []byte
+}
+
+// Params defines a gophercoin network by its parameters. Nodes
+// only talk to the nodes running on the same network and only
+// accept the blocks and addresses of that network.
+type Params struct {
+	// Name is the name of the network, also used as the name of its
+	// directory in the data directory
+	Name string
+
+	// Net is the magic number identifying the messages of the network
+	Net wire.Net
+
+	// DefaultPort is the default port for peer connections
+	DefaultPort string
+
+	// DefaultRESTPort is the default port of the REST API
+	DefaultRESTPort string
+
+	// GenesisCoinbaseData is the data of the genesis coinbase input
+	GenesisCoinbaseData string
+
+	// GenesisTimestamp is the timestamp of the genesis block
+	GenesisTimestamp int64
+
+	// GenesisPubKeyHash is the public key hash the genesis coinbase pays to
+	GenesisPubKeyHash []byte
+
+	// GenesisHash is the hash of the genesis block built from the
+	// genesis parameters
+	GenesisHash []byte
+
+	// PowLimit is the highest target, and therefore the lowest
+	// difficulty, a block can have
+	PowLimit *big.Int
+
+	// PowLimitBits is the compact representation of PowLimit,
+	// used as the difficulty of the genesis block
+	PowLimitBits uint32
+
+	// TargetTimePerBlock is the desired amount of seconds between blocks
+	TargetTimePerBlock int64
+
+	// RetargetInterval is the amount of blocks between
+	// difficulty adjustments
+	RetargetInterval int
+
+	// RetargetAdjustmentFactor limits how much the difficulty can
+	// change in a single adjustment
+	RetargetAdjustmentFactor int64
+
+	// NoRetargeting keeps the difficulty of every block at the
+	// one of the genesis block
+	NoRetargeting bool
+
+	// BaseSubsidy is the amount a coinbase can claim before any halving
+	BaseSubsidy int
+
+	// SubsidyHalvingInterval is the amount of blocks after which
+	// the subsidy is halved, zero meaning it never is
+	SubsidyHalvingInterval int
+
+	// CoinbaseMaturity is the amount of blocks which must be built
+	// on top of a coinbase before its outputs can be spent
+	CoinbaseMaturity int
+
+	// Checkpoints are known good blocks of the main chain, ordered
+	// by height. A block at the height of a checkpoint must have its
+	// hash and once the chain reaches a checkpoint no branch forking
+	// below it is accepted.
+	Checkpoints []Checkpoint
+
+	// AssumeValid is the hash of a block whose ancestors are assumed
+	// to have valid signatures, which are therefore not verified when
+	// they are connected. Nil verifies every signature.
+	AssumeValid []byte
+
+	// GenerateSupported allows mining blocks on demand through the
+	// API, with timestamps controlled by a mock clock
+	GenerateSupported bool
+
+	// AddressVersion is the version byte of the addresses of the network
+	AddressVersion byte
+}
+
+// TargetTimespan returns the desired duration in seconds
+// of a retarget window
+func (p *Params) TargetTimespan() int64 {
+	return int64(p.RetargetInterval) * p.TargetTimePerBlock
+}
+
+// MainNetParams defines the parameters of the main network
+var MainNetParams = Params{
+	Name:            "mainnet",
+	Net:             wire.MainNet,
+	DefaultPort:     "3000",
+	DefaultRESTPort: "9050",
+
+	GenesisCoinbaseData: "May 7 2019, 10:00pm, The Times	Jürgen Klopp makes Liverpool believe they can do the impossible		Matt Dickinson, Chief Sports Writer",
+	GenesisTimestamp:    1557266400,
+	GenesisPubKeyHash:   genesisPubKeyHash,
+	GenesisHash:         mainGenesisHash,
+
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x207fffff,
+	TargetTimePerBlock:       15,
+	RetargetInterval:         10,
+	RetargetAdjustmentFactor: 4,
+	NoRetargeting:            false,
+
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+
+	Checkpoints: []Checkpoint{
+		{Height: 0, Hash: mainGenesisHash},
+	},
+	AssumeValid: nil,
+
+	GenerateSupported: false,
+
+	AddressVersion: 0x00,
+}
+
+// TestNetParams defines the parameters of the test network
+var TestNetParams = Params{
+	Name:            "testnet",
+	Net:             wire.TestNet,
+	DefaultPort:     "13000",
+	DefaultRESTPort: "19050",
+
+	GenesisCoinbaseData: "gophercoin testnet genesis",
+	GenesisTimestamp:    1557266400,
+	GenesisPubKeyHash:   genesisPubKeyHash,
+	GenesisHash:         testGenesisHash,
+
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x207fffff,
+	TargetTimePerBlock:       15,
+	RetargetInterval:         10,
+	RetargetAdjustmentFactor: 4,
+	NoRetargeting:            false,
+
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+
+	Checkpoints: []Checkpoint{
+		{Height: 0, Hash: testGenesisHash},
+	},
+	AssumeValid: nil,
+
+	GenerateSupported: false,
+
+	AddressVersion: 0x6f,
+}
+
+// RegressionNetParams defines the parameters of the regression test
+// network, meant to run local nodes which mine blocks on demand
+var RegressionNetParams = Params{
+	Name:            "regtest",
+	Net:             wire.RegTest,
+	DefaultPort:     "23000",
+	DefaultRESTPort: "29050",
+
+	GenesisCoinbaseData: "gophercoin regtest genesis",
+	GenesisTimestamp:    1557266400,
+	GenesisPubKeyHash:   genesisPubKeyHash,
+	GenesisHash:         newHashFromStr("3ff24bc3b4a2fc722102ff4e8ce1ec078f27c6330adddb7ed73b500b2f8f10dd"),
+
+	PowLimit:                 regressionPowLimit,
+	PowLimitBits:             0x207fffff,
+	TargetTimePerBlock:       15,
+	RetargetInterval:         10,
+	RetargetAdjustmentFactor: 4,
+	NoRetargeting:            true,
+
+	BaseSubsidy:            10,
+	SubsidyHalvingInterval: 150,
+	CoinbaseMaturity:       100,
+
+	Checkpoints: nil,
+	AssumeValid: nil,
+
+	GenerateSupported: true,
+
+	AddressVersion: 0x7a,
+}
+
+// ErrUnknownNet is returned when looking up a network which
+// is not one of the predefined ones
+var ErrUnknownNet = errors.New("unknown network")
+
+// ParamsForName returns the parameters of the predefined
+// network with the given name
+func ParamsForName(name string) (*Params, error) {
+	for _, params := range []*Params{&MainNetParams, &TestNetParams, &RegressionNetParams} {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+
+	return nil, ErrUnknownNet
+}
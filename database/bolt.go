@@ -0,0 +1,122 @@
+package database
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// boltDB is a DB backed by a BoltDB file
+type boltDB struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the BoltDB file at the given path,
+// creating it if it does not exist
+func OpenBolt(path string) (DB, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltDB{db: db}, nil
+}
+
+// View runs fn in a read-only transaction
+func (d *boltDB) View(fn func(tx Tx) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+// Update runs fn in a read-write transaction
+func (d *boltDB) Update(fn func(tx Tx) error) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+// Close closes the BoltDB file
+func (d *boltDB) Close() error {
+	return d.db.Close()
+}
+
+// boltTx is a Tx on a BoltDB file
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Bucket returns the bucket with the given name, or nil if it does not exist
+func (t *boltTx) Bucket(name []byte) Bucket {
+	b := t.tx.Bucket(name)
+	if b == nil {
+		return nil
+	}
+
+	return &boltBucket{b: b}
+}
+
+// CreateBucket creates a new bucket
+func (t *boltTx) CreateBucket(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucket(name)
+	if err == bolt.ErrBucketExists {
+		return nil, ErrBucketExists
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltBucket{b: b}, nil
+}
+
+// CreateBucketIfNotExists returns the bucket with the given name,
+// creating it if it does not exist
+func (t *boltTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	b, err := t.tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &boltBucket{b: b}, nil
+}
+
+// DeleteBucket deletes the bucket with the given name
+func (t *boltTx) DeleteBucket(name []byte) error {
+	err := t.tx.DeleteBucket(name)
+	if err == bolt.ErrBucketNotFound {
+		return ErrBucketNotFound
+	}
+
+	return err
+}
+
+// boltBucket is a Bucket of a BoltDB file
+type boltBucket struct {
+	b *bolt.Bucket
+}
+
+// Get returns the value of the key or nil if it is not set
+func (b *boltBucket) Get(key []byte) []byte {
+	return b.b.Get(key)
+}
+
+// Put sets the value of the key
+func (b *boltBucket) Put(key []byte, value []byte) error {
+	if !b.b.Writable() {
+		return ErrTxNotWritable
+	}
+
+	return b.b.Put(key, value)
+}
+
+// Delete removes the key
+func (b *boltBucket) Delete(key []byte) error {
+	if !b.b.Writable() {
+		return ErrTxNotWritable
+	}
+
+	return b.b.Delete(key)
+}
+
+// Cursor returns a cursor to walk the keys in byte order
+func (b *boltBucket) Cursor() Cursor {
+	return b.b.Cursor()
+}
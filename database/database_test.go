@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBackend runs the same checks against any DB implementation
+func testBackend(t *testing.T, db DB) {
+	bucket := []byte("bucket")
+
+	// Writes are applied once the update succeeds
+	err := db.Update(func(tx Tx) error {
+		b, err := tx.CreateBucket(bucket)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket(bucket)
+		assert.Equal(t, ErrBucketExists, err)
+
+		assert.NoError(t, b.Put([]byte("b"), []byte("2")))
+		assert.NoError(t, b.Put([]byte("a"), []byte("1")))
+		assert.NoError(t, b.Put([]byte("c"), []byte("3")))
+		assert.Equal(t, []byte("1"), b.Get([]byte("a")))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Writes are dropped when the update fails
+	errRollback := errors.New("rollback")
+	err = db.Update(func(tx Tx) error {
+		b := tx.Bucket(bucket)
+		assert.NoError(t, b.Delete([]byte("a")))
+		assert.NoError(t, b.Put([]byte("d"), []byte("4")))
+		assert.Nil(t, b.Get([]byte("a")))
+		return errRollback
+	})
+	assert.Equal(t, errRollback, err)
+
+	err = db.View(func(tx Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("missing")))
+
+		b := tx.Bucket(bucket)
+		assert.Equal(t, []byte("1"), b.Get([]byte("a")))
+		assert.Nil(t, b.Get([]byte("d")))
+		assert.Equal(t, ErrTxNotWritable, b.Put([]byte("e"), []byte("5")))
+
+		// Keys are walked in byte order
+		var keys []string
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+		k, v := c.Seek([]byte("bb"))
+		assert.Equal(t, []byte("c"), k)
+		assert.Equal(t, []byte("3"), v)
+
+		k, _ = c.Seek([]byte("z"))
+		assert.Nil(t, k)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Deleting a bucket drops its content
+	err = db.Update(func(tx Tx) error {
+		assert.NoError(t, tx.DeleteBucket(bucket))
+		assert.Equal(t, ErrBucketNotFound, tx.DeleteBucket(bucket))
+
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		assert.Nil(t, b.Get([]byte("a")))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = db.View(func(tx Tx) error {
+		k, _ := tx.Bucket(bucket).Cursor().First()
+		assert.Nil(t, k)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Close())
+}
+
+// TestMemory checks the in-memory backend
+func TestMemory(t *testing.T) {
+	testBackend(t, NewMemory())
+}
+
+// TestBolt checks the BoltDB backend
+func TestBolt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := OpenBolt(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBackend(t, db)
+}
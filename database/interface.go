@@ -0,0 +1,80 @@
+package database
+
+import "errors"
+
+var (
+	// ErrBucketNotFound is returned when deleting a bucket which does not exist
+	ErrBucketNotFound = errors.New("bucket not found")
+
+	// ErrBucketExists is returned when creating a bucket which already exists
+	ErrBucketExists = errors.New("bucket already exists")
+
+	// ErrTxNotWritable is returned when writing in a read-only transaction
+	ErrTxNotWritable = errors.New("transaction not writable")
+)
+
+// DB is a key/value store organized in buckets, where every
+// read or write happens inside a transaction
+type DB interface {
+	// View runs fn in a read-only transaction
+	View(fn func(tx Tx) error) error
+
+	// Update runs fn in a read-write transaction, which is committed
+	// if fn returns nil and rolled back otherwise, so every write fn
+	// makes is applied as a single batch or not at all
+	Update(fn func(tx Tx) error) error
+
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// Tx is a transaction on a DB, only valid while the
+// function passed to View or Update runs
+type Tx interface {
+	// Bucket returns the bucket with the given name,
+	// or nil if it does not exist
+	Bucket(name []byte) Bucket
+
+	// CreateBucket creates a new bucket, it returns
+	// ErrBucketExists if there is already one with that name
+	CreateBucket(name []byte) (Bucket, error)
+
+	// CreateBucketIfNotExists returns the bucket with the
+	// given name, creating it if it does not exist
+	CreateBucketIfNotExists(name []byte) (Bucket, error)
+
+	// DeleteBucket deletes the bucket with the given name, it
+	// returns ErrBucketNotFound if there is no such bucket
+	DeleteBucket(name []byte) error
+}
+
+// Bucket is a collection of keys and their values
+type Bucket interface {
+	// Get returns the value of the key or nil if it is not set.
+	// The returned value is only valid during the transaction and
+	// must not be modified.
+	Get(key []byte) []byte
+
+	// Put sets the value of the key
+	Put(key []byte, value []byte) error
+
+	// Delete removes the key, deleting a missing key is not an error
+	Delete(key []byte) error
+
+	// Cursor returns a cursor to walk the keys in byte order
+	Cursor() Cursor
+}
+
+// Cursor walks the keys of a bucket in byte order. Every method
+// returns a nil key once there are no more keys to walk.
+type Cursor interface {
+	// First moves to the first key
+	First() (key []byte, value []byte)
+
+	// Next moves to the next key
+	Next() (key []byte, value []byte)
+
+	// Seek moves to the given key, or to the
+	// next one if the key does not exist
+	Seek(seek []byte) (key []byte, value []byte)
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// memoryDB is a DB held in memory, used by tests and by nodes
+// which do not need to keep their chain across restarts
+type memoryDB struct {
+	mutex   sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory creates an empty in-memory DB
+func NewMemory() DB {
+	return &memoryDB{
+		buckets: make(map[string]map[string][]byte),
+	}
+}
+
+// View runs fn in a read-only transaction
+func (d *memoryDB) View(fn func(tx Tx) error) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return fn(newMemoryTx(d, false))
+}
+
+// Update runs fn in a read-write transaction. The writes are kept
+// aside and only applied to the store once fn succeeds.
+func (d *memoryDB) Update(fn func(tx Tx) error) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	tx := newMemoryTx(d, true)
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	tx.commit()
+	return nil
+}
+
+// Close does nothing, the content is dropped with the DB
+func (d *memoryDB) Close() error {
+	return nil
+}
+
+// memoryTx is a Tx on a memoryDB. It holds the buckets touched by the
+// transaction, a nil bucket meaning it was deleted.
+type memoryTx struct {
+	db       *memoryDB
+	writable bool
+	buckets  map[string]*memoryBucket
+}
+
+// newMemoryTx creates a transaction on the given DB
+func newMemoryTx(db *memoryDB, writable bool) *memoryTx {
+	return &memoryTx{
+		db:       db,
+		writable: writable,
+		buckets:  make(map[string]*memoryBucket),
+	}
+}
+
+// Bucket returns the bucket with the given name, or nil if it does not exist
+func (t *memoryTx) Bucket(name []byte) Bucket {
+	if b, touched := t.buckets[string(name)]; touched {
+		if b == nil {
+			return nil
+		}
+		return b
+	}
+
+	base, exists := t.db.buckets[string(name)]
+	if !exists {
+		return nil
+	}
+
+	b := newMemoryBucket(t, base, false)
+	t.buckets[string(name)] = b
+	return b
+}
+
+// CreateBucket creates a new bucket
+func (t *memoryTx) CreateBucket(name []byte) (Bucket, error) {
+	if !t.writable {
+		return nil, ErrTxNotWritable
+	}
+
+	if t.Bucket(name) != nil {
+		return nil, ErrBucketExists
+	}
+
+	b := newMemoryBucket(t, make(map[string][]byte), true)
+	t.buckets[string(name)] = b
+	return b, nil
+}
+
+// CreateBucketIfNotExists returns the bucket with the given name,
+// creating it if it does not exist
+func (t *memoryTx) CreateBucketIfNotExists(name []byte) (Bucket, error) {
+	if b := t.Bucket(name); b != nil {
+		return b, nil
+	}
+
+	return t.CreateBucket(name)
+}
+
+// DeleteBucket deletes the bucket with the given name
+func (t *memoryTx) DeleteBucket(name []byte) error {
+	if !t.writable {
+		return ErrTxNotWritable
+	}
+
+	if t.Bucket(name) == nil {
+		return ErrBucketNotFound
+	}
+
+	t.buckets[string(name)] = nil
+	return nil
+}
+
+// commit applies the writes of the transaction to the DB.
+// The DB write lock must be held.
+func (t *memoryTx) commit() {
+	for name, b := range t.buckets {
+		if b == nil {
+			delete(t.db.buckets, name)
+			continue
+		}
+
+		if b.created {
+			t.db.buckets[name] = b.base
+		}
+
+		for key, value := range b.changes {
+			if value == nil {
+				delete(b.base, key)
+			} else {
+				b.base[key] = value
+			}
+		}
+	}
+}
+
+// memoryBucket is a Bucket of a memoryDB. Reads go through the changes
+// made by the transaction, a nil change meaning the key was deleted,
+// before falling back to the content of the DB.
+type memoryBucket struct {
+	tx      *memoryTx
+	base    map[string][]byte
+	changes map[string][]byte
+	created bool
+}
+
+// newMemoryBucket creates a bucket over the given content
+func newMemoryBucket(tx *memoryTx, base map[string][]byte, created bool) *memoryBucket {
+	return &memoryBucket{
+		tx:      tx,
+		base:    base,
+		changes: make(map[string][]byte),
+		created: created,
+	}
+}
+
+// Get returns the value of the key or nil if it is not set
+func (b *memoryBucket) Get(key []byte) []byte {
+	if value, changed := b.changes[string(key)]; changed {
+		return value
+	}
+
+	return b.base[string(key)]
+}
+
+// Put sets the value of the key
+func (b *memoryBucket) Put(key []byte, value []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+
+	// Keep a copy, the caller may reuse the slice, and
+	// never store a nil value as it marks a deletion
+	b.changes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes the key
+func (b *memoryBucket) Delete(key []byte) error {
+	if !b.tx.writable {
+		return ErrTxNotWritable
+	}
+
+	b.changes[string(key)] = nil
+	return nil
+}
+
+// Cursor returns a cursor over the keys of the bucket as
+// they are when the cursor is created
+func (b *memoryBucket) Cursor() Cursor {
+	var keys []string
+
+	for key := range b.base {
+		if _, changed := b.changes[key]; !changed {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range b.changes {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return &memoryCursor{bucket: b, keys: keys}
+}
+
+// memoryCursor walks a sorted snapshot of the keys of a memoryBucket
+type memoryCursor struct {
+	bucket *memoryBucket
+	keys   []string
+	pos    int
+}
+
+// current returns the key and value at the position of the cursor
+func (c *memoryCursor) current() ([]byte, []byte) {
+	if c.pos >= len(c.keys) {
+		return nil, nil
+	}
+
+	key := []byte(c.keys[c.pos])
+	return key, c.bucket.Get(key)
+}
+
+// First moves to the first key
+func (c *memoryCursor) First() ([]byte, []byte) {
+	c.pos = 0
+	return c.current()
+}
+
+// Next moves to the next key
+func (c *memoryCursor) Next() ([]byte, []byte) {
+	if c.pos < len(c.keys) {
+		c.pos++
+	}
+	return c.current()
+}
+
+// Seek moves to the given key, or to the next one if it does not exist
+func (c *memoryCursor) Seek(seek []byte) ([]byte, []byte) {
+	c.pos = sort.Search(len(c.keys), func(i int) bool {
+		return bytes.Compare([]byte(c.keys[i]), seek) >= 0
+	})
+	return c.current()
+}
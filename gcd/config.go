@@ -1,9 +1,30 @@
 package gcd
 
 import (
+	"encoding/hex"
 	"errors"
 	"flag"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/mempool"
+	"github.com/murlokito/gophercoin/wallet"
+)
+
+const (
+	// defaultDataDirName is the name of the data directory
+	// created in the home directory of the user
+	defaultDataDirName = ".gophercoin"
+	walletsDirName     = "wallets"
+	logsDirName        = "logs"
+	peersFileName      = "peers.json"
+	logFileName        = "gcd.log"
 )
 
 // Config is used as a structure to hold information
@@ -11,49 +32,134 @@ import (
 // into the Server structure to define some of it's
 // parameters
 type Config struct {
-	walletPath    string
-	dbPath        string
+	dataDir       string
+	params        *chaincfg.Params
+	walletName    string
 	peerPort      string
 	restPort      string
 	restPassword  string
 	miningAddr    string
 	miningNode    bool
+	miningWorkers int
 	restProtected bool
+	txIndex       string
+	addrIndex     string
+	maxMempool    int
+	mempoolExpiry time.Duration
 }
 
 func loadConfig() (*Config, error) {
 
 	var (
+		datadirvar   string
+		networkvar   string
 		walletvar    string
-		dbvar        string
 		peervar      string
 		restvar      string
 		protectedvar string
 		passwordvar  string
 		miningvar    string
 		addrvar      string
+		txindexvar   string
+		addrindexvar string
+		assumevalid  string
+		workersvar   int
+		maxmempool   int
+		expiryvar    int
 		mining       = false
 		protected    = false
 	)
 
-	flag.StringVar(&walletvar, "wallet", "", "Path to the wallet.dat file.")
-	flag.StringVar(&dbvar, "db", "", "Path to the blockchain.db file.")
+	flag.StringVar(&datadirvar, "datadir", defaultDataDir(), "Directory holding the chain, wallets, peers and logs.")
+	flag.StringVar(&networkvar, "network", chaincfg.MainNetParams.Name, "Network to run on, `mainnet`, testnet or regtest.")
+	flag.StringVar(&walletvar, "wallet", wallet.Bucket, "Name of the wallet file in the data directory.")
 	flag.StringVar(&peervar, "listen", "", "Port for the daemon to use to listen for peer connections.")
 	flag.StringVar(&restvar, "rest", "", "Port to use for the REST API server.")
 	flag.StringVar(&protectedvar, "protected", "", "If the REST API should be protected by password.")
 	flag.StringVar(&passwordvar, "password", "", "Password to protect the REST API.")
 	flag.StringVar(&miningvar, "mining", "", "Set to `true` to mine, `false` not to.")
 	flag.StringVar(&addrvar, "addr", "", "Address used for mining reward.")
+	flag.IntVar(&workersvar, "miningworkers", runtime.NumCPU(), "Number of goroutines searching for blocks when mining.")
+	flag.StringVar(&txindexvar, "txindex", "", "Set to `true` to maintain a transaction index, `rebuild` to rebuild it or `false` to drop it.")
+	flag.StringVar(&addrindexvar, "addrindex", "", "Set to `true` to maintain an address index, `rebuild` to rebuild it or `false` to drop it.")
+	flag.IntVar(&maxmempool, "maxmempool", mempool.DefaultMaxPoolSize/1000000, "Maximum size of the mempool in megabytes.")
+	flag.IntVar(&expiryvar, "mempoolexpiry", int(mempool.DefaultExpiry/time.Hour), "Hours after which transactions not mined are removed from the mempool.")
+	flag.StringVar(&assumevalid, "assumevalid", "", "Hash of a block whose ancestors' signatures are not verified, `0` to verify every signature.")
 
 	flag.Parse()
 	if len(os.Args) == 0 {
 		return nil, errors.New("no arguments given")
 	}
 
+	if datadirvar == "" {
+		return nil, errors.New("must specify data directory")
+	}
+
+	params, err := chaincfg.ParamsForName(networkvar)
+	if err != nil {
+		return nil, errors.New("network must be mainnet, testnet or regtest")
+	}
+
+	// The network parameters are shared, override the
+	// assume-valid block of a copy of them
+	if assumevalid != "" {
+		custom := *params
+		custom.AssumeValid = nil
+
+		if assumevalid != "0" {
+			hash, err := hex.DecodeString(assumevalid)
+			if err != nil || len(hash) != 32 {
+				return nil, errors.New("assumevalid must be a block hash or 0")
+			}
+			custom.AssumeValid = hash
+		}
+		params = &custom
+	}
+
+	if peervar == "" {
+		peervar = params.DefaultPort
+	}
+
+	if restvar == "" {
+		restvar = params.DefaultRESTPort
+	}
+
+	if walletvar == "" || strings.ContainsAny(walletvar, `/\`) {
+		return nil, errors.New("wallet must be a file name")
+	}
+
 	if protectedvar == "true" && passwordvar == "" {
 		return nil, errors.New("must specify password")
 	}
 
+	switch txindexvar {
+	case "", "true", "false", "rebuild":
+	default:
+		return nil, errors.New("txindex must be true, false or rebuild")
+	}
+
+	switch addrindexvar {
+	case "", "true", "false", "rebuild":
+	default:
+		return nil, errors.New("addrindex must be true, false or rebuild")
+	}
+
+	if addrvar != "" && !address.ValidateAddress(addrvar, params.AddressVersion) {
+		return nil, errors.New("addr is not a valid address of the network")
+	}
+
+	if workersvar < 1 {
+		return nil, errors.New("miningworkers must be at least 1")
+	}
+
+	if maxmempool < 1 {
+		return nil, errors.New("maxmempool must be at least 1")
+	}
+
+	if expiryvar < 1 {
+		return nil, errors.New("mempoolexpiry must be at least 1")
+	}
+
 	if miningvar == "true" {
 		mining = true
 	}
@@ -63,13 +169,75 @@ func loadConfig() (*Config, error) {
 	}
 
 	return &Config{
-		walletPath:    walletvar,
-		dbPath:        dbvar,
+		dataDir:       datadirvar,
+		params:        params,
+		walletName:    walletvar,
 		peerPort:      peervar,
 		restPort:      restvar,
 		miningNode:    mining,
 		miningAddr:    addrvar,
+		miningWorkers: workersvar,
 		restProtected: protected,
 		restPassword:  passwordvar,
+		txIndex:       txindexvar,
+		addrIndex:     addrindexvar,
+		maxMempool:    maxmempool * 1000000,
+		mempoolExpiry: time.Duration(expiryvar) * time.Hour,
 	}, nil
 }
+
+// defaultDataDir returns the data directory used when none is given
+func defaultDataDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return defaultDataDirName
+	}
+
+	return filepath.Join(home, defaultDataDirName)
+}
+
+// netDir returns the directory holding the files of the network
+func (c *Config) netDir() string {
+	return filepath.Join(c.dataDir, c.params.Name)
+}
+
+// chainPath returns the path of the chain db file
+func (c *Config) chainPath() string {
+	return filepath.Join(c.netDir(), blockchain.DBFileName)
+}
+
+// walletPath returns the path of the wallet file with the given
+// name, the wallet extension being added if it is missing
+func (c *Config) walletPath(name string) string {
+	if filepath.Ext(name) != wallet.Extension {
+		name += wallet.Extension
+	}
+
+	return filepath.Join(c.netDir(), walletsDirName, filepath.Base(name))
+}
+
+// peersPath returns the path of the file holding the known nodes
+func (c *Config) peersPath() string {
+	return filepath.Join(c.netDir(), peersFileName)
+}
+
+// logPath returns the path of the log file
+func (c *Config) logPath() string {
+	return filepath.Join(c.netDir(), logsDirName, logFileName)
+}
+
+// createDirs creates the directories of the data directory layout
+func (c *Config) createDirs() error {
+	for _, dir := range []string{
+		c.netDir(),
+		filepath.Join(c.netDir(), walletsDirName),
+		filepath.Join(c.netDir(), logsDirName),
+	} {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -10,11 +10,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/murlokito/gophercoin/blockchain"
 	"github.com/murlokito/gophercoin/peer"
 	"github.com/murlokito/gophercoin/wallet"
+	"github.com/murlokito/gophercoin/wire"
 
 	"github.com/gorilla/mux"
 )
@@ -49,6 +50,8 @@ type ResponseTx struct {
 	ID   []byte                 `json:"ID"`
 	Vin  []transaction.TXInput  `json:"Vin"`
 	Vout []transaction.TXOutput `json:"Vout"`
+	Fee  int                    `json:"Fee,omitempty"`
+	Size int                    `json:"Size,omitempty"`
 }
 
 // ResponseListTx defined to be used for serialization purposes
@@ -68,12 +71,15 @@ type ResponseListAddresses struct {
 
 // ResponseBlock defined to be used for serialization purposes
 type ResponseBlock struct {
+	Version       int32
 	Timestamp     int64
 	PrevBlockHash []byte
+	MerkleRoot    []byte
 	Transactions  []*transaction.Transaction
 	Hash          []byte
-	Nonce         int
+	Nonce         uint32
 	Height        int
+	Bits          uint32
 	ProofOfWork   string
 }
 
@@ -82,6 +88,11 @@ type ResponseListBlocks struct {
 	Blocks []ResponseBlock `json:"Blocks,omitempty"`
 }
 
+// ResponseGenerate defined to be used for serialization purposes
+type ResponseGenerate struct {
+	Hashes [][]byte `json:"Hashes"`
+}
+
 // ResponseCreateBlockchain defined to be used for serialization purposes
 type ResponseCreateBlockchain struct {
 	Status      int    `json:"Status"`
@@ -97,8 +108,87 @@ type ResponseCreateWallet struct {
 
 // ResponseBalance defined to be used for serialization purposes
 type ResponseBalance struct {
-	Address string `json:"Address,omitempty"`
-	Balance int64  `json:"Balance,omitempty"`
+	Address   string `json:"Address,omitempty"`
+	Balance   int64  `json:"Balance,omitempty"`
+	Spendable int64  `json:"Spendable"`
+	Immature  int64  `json:"Immature"`
+}
+
+// ResponseHistoryTx defined to be used for serialization purposes
+type ResponseHistoryTx struct {
+	BlockHash []byte                  `json:"BlockHash"`
+	Height    int                     `json:"Height"`
+	Tx        transaction.Transaction `json:"Transaction"`
+}
+
+// ResponseHistory defined to be used for serialization purposes
+type ResponseHistory struct {
+	Address      string              `json:"Address"`
+	Total        int                 `json:"Total"`
+	Transactions []ResponseHistoryTx `json:"Transactions,omitempty"`
+}
+
+// ResponseMerkleProof defined to be used for serialization purposes
+type ResponseMerkleProof struct {
+	BlockHash  []byte   `json:"BlockHash"`
+	Height     int      `json:"Height"`
+	MerkleRoot []byte   `json:"MerkleRoot"`
+	TxID       []byte   `json:"TxID"`
+	Index      int      `json:"Index"`
+	Hashes     [][]byte `json:"Hashes"`
+}
+
+// ResponseTemplateTx defined to be used for serialization purposes
+type ResponseTemplateTx struct {
+	ID   []byte `json:"ID"`
+	Data []byte `json:"Data"`
+}
+
+// ResponseBlockTemplate defined to be used for serialization purposes
+type ResponseBlockTemplate struct {
+	Version       int32                `json:"Version"`
+	PrevBlockHash []byte               `json:"PrevBlockHash"`
+	Height        int                  `json:"Height"`
+	Bits          uint32               `json:"Bits"`
+	Target        []byte               `json:"Target"`
+	Timestamp     int64                `json:"Timestamp"`
+	MinTimestamp  int64                `json:"MinTimestamp"`
+	CoinbaseValue int                  `json:"CoinbaseValue"`
+	Transactions  []ResponseTemplateTx `json:"Transactions"`
+}
+
+// RequestSubmitBlock defined to be used for deserialization purposes,
+// the block is in the encoding used to store and relay blocks
+type RequestSubmitBlock struct {
+	Block []byte `json:"Block"`
+}
+
+// ResponseSubmitBlock defined to be used for serialization purposes
+type ResponseSubmitBlock struct {
+	Status string `json:"Status"`
+	Hash   []byte `json:"Hash"`
+	Height int    `json:"Height"`
+}
+
+// ResponseMiningTemplate defined to be used for serialization purposes
+type ResponseMiningTemplate struct {
+	Height        int      `json:"Height"`
+	PrevBlockHash []byte   `json:"PrevBlockHash"`
+	Bits          uint32   `json:"Bits"`
+	CoinbaseValue int      `json:"CoinbaseValue"`
+	Transactions  [][]byte `json:"Transactions"`
+}
+
+// ResponseMiningInfo defined to be used for serialization purposes
+type ResponseMiningInfo struct {
+	Mining        bool                    `json:"Mining"`
+	Address       string                  `json:"Address"`
+	Workers       int                     `json:"Workers"`
+	HashRate      float64                 `json:"HashRate"`
+	BlocksFound   int                     `json:"BlocksFound"`
+	LastBlockHash []byte                  `json:"LastBlockHash,omitempty"`
+	LastBlockTime int64                   `json:"LastBlockTime,omitempty"`
+	Template      *ResponseMiningTemplate `json:"Template,omitempty"`
 }
 
 // ResponseSubmitTx defined to be used for serialization purposes
@@ -134,12 +224,12 @@ func (s *Server) CreateWallet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	w.Header().Set("Content-Type", "application/json")
 
-	if vars["WalletFile"] == "" {
-		respondWithError(w, http.StatusBadRequest, "Empty transaction")
-		return
+	name := vars["WalletFile"]
+	if name == "" {
+		name = s.cfg.walletName
 	}
 
-	wallet, err := wallet.NewWallet(vars["WalletFile"])
+	wallet, err := wallet.NewWallet(s.cfg.walletPath(name), s.cfg.params.AddressVersion)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest,
 			fmt.Errorf("Failed to create new Wallet: %+v", err).Error())
@@ -183,7 +273,7 @@ func (s *Server) NodeInfo(w http.ResponseWriter, r *http.Request) {
 
 	var response ResponseInfo
 
-	if s.cfg.miningNode == true {
+	if s.miner.IsMining() {
 		response.Mining = "true"
 	} else {
 		response.Mining = "false"
@@ -192,7 +282,7 @@ func (s *Server) NodeInfo(w http.ResponseWriter, r *http.Request) {
 	if s.peerServer.Config.Port != "" {
 		response.Protocol = s.peerServer.Config.Port
 	} else {
-		response.Protocol = peer.DefaultProtocolPort
+		response.Protocol = s.cfg.params.DefaultPort
 	}
 
 	response.Peers = len(s.peerServer.KnownNodes)
@@ -242,14 +332,18 @@ func (s *Server) ListBlocks(w http.ResponseWriter, r *http.Request) {
 	for {
 		block := bci.Next()
 
-		pow := blockchain.NewProofOfWork(block)
+		pow := blockchain.NewProofOfWork(&block.BlockHeader)
 		b := ResponseBlock{
+			Version:       block.Version,
 			Timestamp:     block.Timestamp,
 			Height:        block.Height,
 			PrevBlockHash: block.PrevBlockHash,
+			MerkleRoot:    block.MerkleRoot,
 			Transactions:  block.Transactions,
 			Hash:          block.Hash,
-			ProofOfWork:   strconv.FormatBool(pow.Validate()),
+			Nonce:         block.Nonce,
+			Bits:          block.Bits,
+			ProofOfWork:   strconv.FormatBool(pow.Validate(s.chainMgr.Chain)),
 		}
 		responseList.Blocks = append(responseList.Blocks, b)
 
@@ -262,23 +356,276 @@ func (s *Server) ListBlocks(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// GetBlockByHeight is the handler for the '/get_block/{Height}' endpoint,
+// which returns the main chain block at the given height.
+func (s *Server) GetBlockByHeight(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.chainMgr == nil || s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest, "Blockchain uninitialized")
+		return
+	}
+
+	height, err := strconv.Atoi(vars["Height"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid height")
+		return
+	}
+
+	block, err := s.chainMgr.Chain.GetBlockByHeight(height)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	pow := blockchain.NewProofOfWork(&block.BlockHeader)
+	b := ResponseBlock{
+		Version:       block.Version,
+		Timestamp:     block.Timestamp,
+		Height:        block.Height,
+		PrevBlockHash: block.PrevBlockHash,
+		MerkleRoot:    block.MerkleRoot,
+		Transactions:  block.Transactions,
+		Hash:          block.Hash,
+		Nonce:         block.Nonce,
+		Bits:          block.Bits,
+		ProofOfWork:   strconv.FormatBool(pow.Validate(s.chainMgr.Chain)),
+	}
+
+	respondWithJSON(w, http.StatusOK, b)
+}
+
+// GetMerkleProof is the handler for the '/get_merkle_proof/{BlockHash}/{TxID}'
+// endpoint, which returns the proof that the transaction is part of the block,
+// to be checked against the merkle root of the block's header.
+func (s *Server) GetMerkleProof(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.chainMgr == nil || s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest, "Blockchain uninitialized")
+		return
+	}
+
+	blockHash, err := hex.DecodeString(vars["BlockHash"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid block hash")
+		return
+	}
+
+	txID, err := hex.DecodeString(vars["TxID"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	block, err := s.chainMgr.Chain.GetBlock(blockHash)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	proof, err := block.TxMerkleProof(txID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ResponseMerkleProof{
+		BlockHash:  block.Hash,
+		Height:     block.Height,
+		MerkleRoot: block.MerkleRoot,
+		TxID:       txID,
+		Index:      proof.Index,
+		Hashes:     proof.Hashes,
+	})
+}
+
+// GetBlockTemplate is the handler for the '/get_block_template' endpoint,
+// which hands out what a miner running outside the node needs to build
+// a block on top of the tip
+func (s *Server) GetBlockTemplate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.chainMgr == nil || s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest, "Blockchain uninitialized")
+		return
+	}
+
+	template, err := s.chainMgr.NewBlockTemplate()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The target is given as a 32 byte big endian number,
+	// the same width as the block hashes it is compared to
+	target := make([]byte, 32)
+	targetBytes := template.Target.Bytes()
+	copy(target[len(target)-len(targetBytes):], targetBytes)
+
+	response := ResponseBlockTemplate{
+		Version:       template.Version,
+		PrevBlockHash: template.PrevBlockHash,
+		Height:        template.Height,
+		Bits:          template.Bits,
+		Target:        target,
+		Timestamp:     template.Timestamp,
+		MinTimestamp:  template.MinTimestamp,
+		CoinbaseValue: template.CoinbaseValue,
+		Transactions:  []ResponseTemplateTx{},
+	}
+	for _, tx := range template.Transactions {
+		response.Transactions = append(response.Transactions, ResponseTemplateTx{
+			ID:   tx.ID,
+			Data: tx.Serialize(),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// SubmitBlock is the handler for the '/submit_block' endpoint, which
+// validates a block solved outside the node, connects it and announces
+// it to the peers
+func (s *Server) SubmitBlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.chainMgr == nil || s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest, "Blockchain uninitialized")
+		return
+	}
+
+	var request RequestSubmitBlock
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	block, err := blockchain.DeserializeBlock(request.Block)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid block")
+		return
+	}
+
+	err = s.chainMgr.Chain.SubmitBlock(block)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, node := range s.peerServer.KnownNodes {
+		if node.Address != s.peerServer.NodeAddress {
+			s.peerServer.SendInv(node.Address, wire.InvTypeBlock, [][]byte{block.Hash})
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, ResponseSubmitBlock{
+		Status: "OK",
+		Hash:   block.Hash,
+		Height: block.Height,
+	})
+}
+
+// miningInfo returns the state of the miner
+func (s *Server) miningInfo() ResponseMiningInfo {
+	stats := s.miner.Stats()
+	info := ResponseMiningInfo{
+		Mining:        stats.Mining,
+		Address:       stats.Address,
+		Workers:       stats.Workers,
+		HashRate:      stats.HashRate,
+		BlocksFound:   stats.BlocksFound,
+		LastBlockHash: stats.LastBlockHash,
+	}
+	if !stats.LastBlockTime.IsZero() {
+		info.LastBlockTime = stats.LastBlockTime.Unix()
+	}
+
+	if stats.Template != nil {
+		info.Template = &ResponseMiningTemplate{
+			Height:        stats.Template.Height,
+			PrevBlockHash: stats.Template.PrevBlockHash,
+			Bits:          stats.Template.Bits,
+			CoinbaseValue: stats.Template.CoinbaseValue,
+			Transactions:  [][]byte{},
+		}
+		for _, tx := range stats.Template.Transactions {
+			info.Template.Transactions = append(info.Template.Transactions, tx.ID)
+		}
+	}
+
+	return info
+}
+
+// MiningInfo is the handler for the '/mining_info' endpoint, which
+// reports whether the node is mining, its hashrate, the blocks it found
+// and the template of the block it is searching for
+func (s *Server) MiningInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	respondWithJSON(w, http.StatusOK, s.miningInfo())
+}
+
+// StartMining is the handler for the '/start_mining' endpoint
+func (s *Server) StartMining(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !address2.ValidateAddress(s.miner.MiningAddress(), s.cfg.params.AddressVersion) {
+		respondWithError(w, http.StatusBadRequest, "No mining address, set one with /set_mining_address")
+		return
+	}
+
+	s.miner.StartMiner()
+	respondWithJSON(w, http.StatusOK, s.miningInfo())
+}
+
+// StopMining is the handler for the '/stop_mining' endpoint, the
+// search for the current block is abandoned
+func (s *Server) StopMining(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	s.miner.StopMiner()
+	respondWithJSON(w, http.StatusOK, s.miningInfo())
+}
+
+// SetMiningAddress is the handler for the '/set_mining_address/{Address}'
+// endpoint, which changes the address the rewards of the mined blocks go to
+func (s *Server) SetMiningAddress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if !address2.ValidateAddress(vars["Address"], s.cfg.params.AddressVersion) {
+		respondWithError(w, http.StatusBadRequest, "Invalid wallet address")
+		return
+	}
+
+	s.miner.SetMiningAddress(vars["Address"])
+	respondWithJSON(w, http.StatusOK, s.miningInfo())
+}
+
 // ListMempool is the handler for the '/list_mempool' endpoint, which is
 // responsible for asking the wallet for a new address.
 func (s *Server) ListMempool(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	if len(s.chainMgr.MemPool) < 1 {
+	descs := s.txPool.TxDescs()
+	if len(descs) < 1 {
 		respondWithError(w, http.StatusBadRequest, "No transactions in mempool")
 		return
 	}
 
 	var responseListTxs ResponseListTx
 
-	for _, tx := range s.chainMgr.MemPool {
+	for _, desc := range descs {
 		newtx := ResponseTx{
-			ID:   tx.ID,
-			Vin:  tx.Vin,
-			Vout: tx.Vout,
+			ID:   desc.Tx.ID,
+			Vin:  desc.Tx.Vin,
+			Vout: desc.Tx.Vout,
+			Fee:  desc.Fee,
+			Size: desc.Size,
 		}
 		responseListTxs.Transactions = append(responseListTxs.Transactions, newtx)
 	}
@@ -289,32 +636,18 @@ func (s *Server) ListMempool(w http.ResponseWriter, r *http.Request) {
 
 // CreateBlockchain is the handler for the '/create_blockchain' endpoint
 func (s *Server) CreateBlockchain(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
 	w.Header().Set("Content-Type", "application/json")
 
-	if vars["WalletFile"] == "" {
-		respondWithError(w, http.StatusBadRequest, "Empty transaction")
-		return
-	}
-
-	if s.wallet == nil {
-		wallet, err := wallet.NewWallet(vars["WalletFile"])
-		if err != nil {
-			respondWithError(w, http.StatusBadRequest, fmt.Errorf("Wallet uninitialized: %+v", err).Error())
-			return
-		}
-		s.wallet = wallet
-	}
-
-	addr := s.wallet.CreateAddress()
-	log.Printf("Mining genesis block to address: %v", addr)
-	db, err := blockchain.CreateBlockchain(addr)
+	log.Printf("Creating blockchain of %s", s.cfg.params.Name)
+	db, err := blockchain.CreateBlockchain(s.cfg.chainPath(), s.cfg.params)
 	var msg string
 	if err != nil {
 		msg = fmt.Errorf("Failed to create db: %+v", err).Error()
 	}
 
-	s.chainMgr.Chain = db
+	if err == nil {
+		s.chainMgr.SetChain(db)
+	}
 
 	if msg != "" {
 		respondWithJSON(w, http.StatusOK, ResponseMessage{
@@ -346,41 +679,24 @@ func (s *Server) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 		}
 
+		// The chain keeps the UTXO set up to date as blocks are
+		// connected, only the view over it may be missing
 		if s.chainMgr.UTXOSet == nil {
-			log.Printf("utxoSet not found, creating it.")
-			// perform task
-			UTXOSet := &blockchain.UTXOSet{
+			s.chainMgr.UTXOSet = &blockchain.UTXOSet{
 				Chain: s.chainMgr.Chain,
-				Mutex: &sync.RWMutex{},
 			}
-			s.chainMgr.UTXOSet = UTXOSet
-
-			go func() {
-				s.chainMgr.UTXOSet.Reindex()
-				ctx := s.chainMgr.UTXOSet.CountTransactions()
-				log.Printf("Finished reindexing utxoSet, there are %d transactions in it.", ctx)
-			}()
-
-			respondWithJSON(w, http.StatusOK, ResponseMessage{
-				Description: "Reindexing UTXOs.",
-			})
-			return
-
 		}
 		pubKeyHash := address2.Base58Decode([]byte(data["Address"]))
 		pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-		UTXOs := s.chainMgr.UTXOSet.FindUTXO(pubKeyHash)
-
-		if len(UTXOs) >= 1 {
-			for _, out := range UTXOs {
+		spendable, immature := s.chainMgr.UTXOSet.GetBalance(pubKeyHash)
+		balance = spendable + immature
 
-				balance += out.Value
-			}
-		}
-		log.Printf("Address: %v Balance: %v", string(data["Address"]), balance)
+		log.Printf("Address: %v Balance: %v (%v immature)", string(data["Address"]), balance, immature)
 		respondWithJSON(w, http.StatusOK, ResponseBalance{
-			Address: data["Address"],
-			Balance: int64(balance),
+			Address:   data["Address"],
+			Balance:   int64(balance),
+			Spendable: int64(spendable),
+			Immature:  int64(immature),
 		})
 		return
 	}
@@ -391,54 +707,179 @@ func (s *Server) GetBalance(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// GenerateBlocks is the handler for the '/generate_blocks/{Amount}' endpoint
-func (s *Server) GenerateBlocks(w http.ResponseWriter, r *http.Request) {
+// GetHistory is the handler for the '/get_history/{Address}/{Skip}/{Count}'
+// endpoint, which returns a page of the transactions of the address, newest first.
+func (s *Server) GetHistory(w http.ResponseWriter, r *http.Request) {
+	data := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest, "Blockchain uninitialized")
+		return
+	}
 
+	if !address2.ValidateAddress(data["Address"], s.cfg.params.AddressVersion) {
+		respondWithError(w, http.StatusBadRequest, "Invalid address")
+		return
+	}
+
+	skip, err := strconv.Atoi(data["Skip"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid skip")
+		return
+	}
+
+	count, err := strconv.Atoi(data["Count"])
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid count")
+		return
+	}
+
+	pubKeyHash := address2.Base58Decode([]byte(data["Address"]))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	history, total, err := s.chainMgr.Chain.AddressHistory(pubKeyHash, skip, count)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := ResponseHistory{
+		Address: data["Address"],
+		Total:   total,
+	}
+	for _, entry := range history {
+		response.Transactions = append(response.Transactions, ResponseHistoryTx{
+			BlockHash: entry.BlockHash,
+			Height:    entry.Height,
+			Tx:        *entry.Tx,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// generate mines the amount of blocks to the address, answering with an
+// error if it fails. The hashes of the blocks are returned, or nil on error.
+func (s *Server) generate(w http.ResponseWriter, amount string, addr string) [][]byte {
+	if s.chainMgr.Chain == nil {
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Errorf("Blockhain not found").Error())
+		return nil
+	}
+
+	amt, err := strconv.Atoi(amount)
+	if err != nil || amt < 1 {
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Errorf("Error validating input").Error())
+		return nil
+	}
+
+	log.Printf("Generating %v blocks.", amt)
+	hashes, err := s.chainMgr.GenerateToAddress(amt, addr)
+	if err == blockchain.ErrGenerateNotSupported {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+
+	return hashes
+}
+
+// GenerateBlocks is the handler for the '/generate_blocks/{Amount}' endpoint,
+// which mines blocks paying the mining address on networks supporting it
+func (s *Server) GenerateBlocks(w http.ResponseWriter, r *http.Request) {
 	data := mux.Vars(r)
 	w.Header().Set("Content-Type", "application/json")
 
-	if data["Amount"] != "" {
-		log.Printf("Generating %v blocks.", data["Amount"])
+	addr := s.miner.MiningAddress()
+	if !address2.ValidateAddress(addr, s.cfg.params.AddressVersion) {
+		respondWithError(w, http.StatusBadRequest, "No mining address, set one with /set_mining_address")
+		return
+	}
 
-		if s.chainMgr.Chain == nil {
-			respondWithError(w, http.StatusBadRequest,
-				fmt.Errorf("Blockhain not found").Error())
-			return
+	hashes := s.generate(w, data["Amount"], addr)
+	if hashes == nil {
+		return
+	}
 
-		}
-		addr := s.wallet.CreateAddress()
-		amt, err := strconv.Atoi(data["Amount"])
+	var responseList ResponseListBlocks
+	for _, hash := range hashes {
+		newBlock, err := s.chainMgr.Chain.GetBlock(hash)
 		if err != nil {
-			respondWithError(w, http.StatusBadRequest,
-				fmt.Errorf("Error validating input").Error())
+			respondWithError(w, http.StatusInternalServerError, err.Error())
 			return
-
 		}
-		var responseList ResponseListBlocks
-		for i := 0; i < amt; i++ {
-			cbTx := transaction.NewCoinbaseTX(addr, "")
-			txs := []*transaction.Transaction{cbTx}
-
-			newBlock := s.chainMgr.Chain.MineBlock(txs)
-			s.chainMgr.UTXOSet.Update(newBlock)
-
-			pow := blockchain.NewProofOfWork(newBlock)
-			b := ResponseBlock{
-				Height:        newBlock.Height,
-				PrevBlockHash: newBlock.PrevBlockHash,
-				Transactions:  newBlock.Transactions,
-				Hash:          newBlock.Hash,
-				ProofOfWork:   strconv.FormatBool(pow.Validate()),
-			}
-			responseList.Blocks = append(responseList.Blocks, b)
+
+		pow := blockchain.NewProofOfWork(&newBlock.BlockHeader)
+		b := ResponseBlock{
+			Version:       newBlock.Version,
+			Timestamp:     newBlock.Timestamp,
+			Height:        newBlock.Height,
+			PrevBlockHash: newBlock.PrevBlockHash,
+			MerkleRoot:    newBlock.MerkleRoot,
+			Transactions:  newBlock.Transactions,
+			Hash:          newBlock.Hash,
+			Nonce:         newBlock.Nonce,
+			Bits:          newBlock.Bits,
+			ProofOfWork:   strconv.FormatBool(pow.Validate(s.chainMgr.Chain)),
 		}
-		respondWithJSON(w, http.StatusOK, responseList)
+		responseList.Blocks = append(responseList.Blocks, b)
+	}
 
+	respondWithJSON(w, http.StatusOK, responseList)
+}
+
+// GenerateToAddress is the handler for the '/generate_to_address/{Amount}/{Address}'
+// endpoint, which synchronously mines blocks paying the given address on
+// networks supporting it and returns their hashes
+func (s *Server) GenerateToAddress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if !address2.ValidateAddress(vars["Address"], s.cfg.params.AddressVersion) {
+		respondWithError(w, http.StatusBadRequest, "Invalid wallet address")
+		return
+	}
+
+	hashes := s.generate(w, vars["Amount"], vars["Address"])
+	if hashes == nil {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, ResponseGenerate{Hashes: hashes})
+}
+
+// SetMockTime is the handler for the '/set_mock_time/{Timestamp}' endpoint,
+// which sets the time of the clock of the node in seconds since the epoch,
+// 0 going back to the time of the system. The timestamps of the blocks
+// generated follow it. It is only available on networks generating blocks.
+func (s *Server) SetMockTime(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if s.mockClock == nil {
+		respondWithError(w, http.StatusBadRequest, "Mock time is not supported on this network")
+		return
 	}
-	respondWithError(w, http.StatusBadRequest,
-		fmt.Errorf("Error validating input").Error())
-	return
 
+	timestamp, err := strconv.ParseInt(vars["Timestamp"], 10, 64)
+	if err != nil || timestamp < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid timestamp")
+		return
+	}
+
+	if timestamp == 0 {
+		s.mockClock.SetMockTime(time.Time{})
+	} else {
+		s.mockClock.SetMockTime(time.Unix(timestamp, 0))
+	}
+
+	respondWithJSON(w, http.StatusOK, ResponseMessage{
+		Description: fmt.Sprintf("Mock time set to %d", timestamp),
+	})
 }
 
 // SubmitTx is the handler for the '/submit_tx/{Transaction}' endpoint
@@ -452,12 +893,12 @@ func (s *Server) SubmitTx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !address2.ValidateAddress(vars["From"]) {
+	if !address2.ValidateAddress(vars["From"], s.cfg.params.AddressVersion) {
 		respondWithError(w, http.StatusBadRequest, "Invalid wallet address")
 		return
 	}
 
-	if !address2.ValidateAddress(vars["To"]) {
+	if !address2.ValidateAddress(vars["To"], s.cfg.params.AddressVersion) {
 		respondWithError(w, http.StatusBadRequest, "Invalid destiny address")
 		return
 	}
@@ -469,21 +910,41 @@ func (s *Server) SubmitTx(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	pubKeyHash := address2.HashPubKey(address.PublicKey)
-	acc, validOutputs := s.chainMgr.UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
 
-	tx, err := transaction.NewUTXOTransaction(acc, validOutputs, vars["To"], amount, address.GetAddress())
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
-		return
-	}
+	// The transaction pays the minimum fee of the mempool for its
+	// size, which is only known once it is built and signed, and
+	// which rises while the mempool is full
+	var tx *transaction.Transaction
+	fee := 0
+	for {
+		acc, validOutputs := s.chainMgr.UTXOSet.FindSpendableOutputs(pubKeyHash, amount+fee)
 
-	prevTxs, err := s.chainMgr.Chain.FindPreviousTransactions(tx)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
-		return
+		tx, err = transaction.NewUTXOTransaction(acc, validOutputs, vars["To"], amount, fee, address.PublicKey)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		prevTxs, err := s.chainMgr.Chain.FindPreviousTransactions(tx)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err = tx.Sign(address.PrivateKey, prevTxs)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		minFee := s.txPool.MinRequiredFee(len(tx.Serialize()))
+		if fee >= minFee {
+			break
+		}
+		fee = minFee
 	}
 
-	err = tx.Sign(address.PrivateKey, prevTxs)
+	err = s.txPool.ProcessTransaction(tx)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
@@ -494,19 +955,18 @@ func (s *Server) SubmitTx(w http.ResponseWriter, r *http.Request) {
 		Tx:     *tx,
 	}
 
-	if s.peerServer.KnownNodes != nil {
-		s.chainMgr.MemPool[hex.EncodeToString(tx.ID)] = *tx
+	if len(s.peerServer.KnownNodes) == 0 {
 		p.Status = "No peers available, added to mempool."
-		if (s.miner.MinerChan) != nil {
-			s.miner.MinerChan <- tx.ID
-		}
-	} else {
-		for _, node := range s.peerServer.KnownNodes {
-			if node.Address != s.peerServer.NodeAddress {
-				s.peerServer.SendInv(node.Address, "tx", [][]byte{tx.ID})
-			}
+	}
+	for _, node := range s.peerServer.KnownNodes {
+		if node.Address != s.peerServer.NodeAddress {
+			s.peerServer.SendInv(node.Address, wire.InvTypeTx, [][]byte{tx.ID})
 		}
-		s.chainMgr.MemPool[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	select {
+	case s.miner.MinerChan <- tx.ID:
+	default:
 	}
 
 	respondWithJSON(w, http.StatusOK, p)
@@ -526,7 +986,7 @@ func (s *Server) AddNode(w http.ResponseWriter, r *http.Request) {
 	ip, port := splitInput[0], splitInput[1]
 
 	if ip == "localhost" || ip == "127.0.0.1" || ip == "" {
-		if port == peer.DefaultProtocolPort {
+		if port == s.peerServer.Config.Port {
 			respondWithError(w, http.StatusBadRequest, "Cannot add own node")
 			return
 		}
@@ -553,6 +1013,7 @@ func (s *Server) AddNode(w http.ResponseWriter, r *http.Request) {
 	s.peerServer.KnownNodes = append(s.peerServer.KnownNodes, peer.Peer{
 		Address: vars["Address"],
 	})
+	s.peerServer.SavePeers()
 
 	s.peerServer.SendVersion(vars["Address"])
 
@@ -1,22 +1,48 @@
 package gcd
 
 import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
 	"github.com/murlokito/gophercoin/blockchain"
 	log "github.com/murlokito/gophercoin/log"
+	"github.com/murlokito/gophercoin/mempool"
 	"github.com/murlokito/gophercoin/mining"
 	"github.com/murlokito/gophercoin/peer"
 	"github.com/murlokito/gophercoin/wallet"
 	"sync"
 )
 
+// shutdownTimeout is how long the requests being handled by
+// the REST API are waited for when shutting down
+const shutdownTimeout = 10 * time.Second
+
 // gcdMain is the real main entrypoint for gophercoind.  It is necessary to work around
 // the fact that deferred functions do not run when os.Exit() is called.  The
 // optional serverChan parameter is mainly used by the service code to be
 // notified with the server once it is setup so it can gracefully stop it when
 // requested from the service control manager.
 func gcdMain(serverChan chan<- *Server, cfg *Config) error {
-	// Load configuration and parse command line.  This function also
-	// initializes logging and configures it accordingly.
+	// Lay out the data directory and send the logs to its log
+	// file as well as to the standard output
+	err := cfg.createDirs()
+	if err != nil {
+		return err
+	}
+
+	logFile, err := os.OpenFile(cfg.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+
 	logger := log.NewLogger(log.InfoLevel)
 	logger.Info("Preparing to launch.")
 	var (
@@ -27,80 +53,155 @@ func gcdMain(serverChan chan<- *Server, cfg *Config) error {
 		miner      *mining.MinerServer
 	)
 
+	logger.WithDetails(
+		log.NewDetail("datadir", cfg.dataDir),
+		log.NewDetail("network", cfg.params.Name),
+	).Info("Using data directory")
+
 	// attempt to load the wallet from file
-	w, err := wallet.NewWallet(cfg.walletPath)
+	w, err = wallet.NewWallet(cfg.walletPath(cfg.walletName), cfg.params.AddressVersion)
 	if err != nil {
 		return err
 	}
 	logger.WithDetails(
-		log.NewDetail("wallet", cfg.walletPath),
+		log.NewDetail("wallet", cfg.walletPath(cfg.walletName)),
 	).Info("Successfully loaded wallet")
 
-	// attempt to load the database from file
-	chain, err := blockchain.NewBlockchain(cfg.dbPath)
+	// the rewards go to the first address of the wallet unless
+	// another one is given, there must be one to start mining
+	miningAddr := cfg.miningAddr
+	if miningAddr == "" {
+		miningAddr = w.GetInitialAddress()
+	}
+	if cfg.miningNode && !address.ValidateAddress(miningAddr, cfg.params.AddressVersion) {
+		return errors.New("mining requires an address, pass one with -addr")
+	}
+
+	// load the database from file, creating it only when there is
+	// none yet so the errors of an existing one are not hidden
+	var chain *blockchain.Blockchain
+	if _, err = os.Stat(cfg.chainPath()); os.IsNotExist(err) {
+		chain, err = blockchain.CreateBlockchain(cfg.chainPath(), cfg.params)
+	} else {
+		chain, err = blockchain.NewBlockchain(cfg.chainPath(), cfg.params)
+	}
 	if err != nil {
-		newChain, err := blockchain.CreateBlockchain(w.CreateAddress())
+		return err
+	}
+	logger.WithDetails(
+		log.NewDetail("database", cfg.chainPath()),
+	).Info("Successfully loaded database")
+
+	// build or drop the transaction index as requested
+	switch {
+	case cfg.txIndex == "rebuild" || (cfg.txIndex == "true" && !chain.HasTxIndex()):
+		logger.Info("Building transaction index.")
+		err = chain.BuildTxIndex()
+		if err != nil {
+			return err
+		}
+		logger.Info("Finished building transaction index.")
+	case cfg.txIndex == "false":
+		err = chain.DropTxIndex()
 		if err != nil {
 			return err
 		}
-		chain = newChain
 	}
-	logger.WithDetails(
-		log.NewDetail("database", cfg.dbPath),
-	).Info("Successfully loaded database")
 
-	// attempt to load and reindex utxo set
+	// build or drop the address index as requested
+	switch {
+	case cfg.addrIndex == "rebuild" || (cfg.addrIndex == "true" && !chain.HasAddrIndex()):
+		logger.Info("Building address index.")
+		err = chain.BuildAddrIndex()
+		if err != nil {
+			return err
+		}
+		logger.Info("Finished building address index.")
+	case cfg.addrIndex == "false":
+		err = chain.DropAddrIndex()
+		if err != nil {
+			return err
+		}
+	}
+
+	// the utxo set is kept up to date by the chain as blocks are connected
 	utxoSet := &blockchain.UTXOSet{
 		Chain: chain,
-		Mutex: &sync.RWMutex{},
 	}
 
 	logger.WithDetails(
-		log.NewDetail("database", cfg.dbPath),
+		log.NewDetail("database", cfg.chainPath()),
 	).Info("Successfully loaded utxo set")
 
-	// initialize the chain manager to pass onto other components
+	// initialize the chain manager to pass onto other components,
+	// along with the mempool it keeps in sync with the chain
 	chainMgr := blockchain.NewChainManager(chain, utxoSet)
+	policy := mempool.DefaultPolicy()
+	policy.MaxPoolSize = cfg.maxMempool
+	policy.Expiry = cfg.mempoolExpiry
+	txPool := mempool.New(policy, chainMgr)
+	chainMgr.TxSource = txPool
+
+	// networks generating blocks on demand run on a clock
+	// which can be set through the REST API
+	var mockClock *blockchain.MockClock
+	if cfg.params.GenerateSupported {
+		mockClock = blockchain.NewMockClock()
+		chainMgr.SetTimeSource(blockchain.NewMedianTime(mockClock))
+	}
 
 	peerConfig := peer.Config{
-		Port:     cfg.peerPort,
-		LogLevel: log.InfoLevel,
+		Port:      cfg.peerPort,
+		LogLevel:  log.InfoLevel,
+		Params:    cfg.params,
+		DBPath:    cfg.chainPath(),
+		PeersFile: cfg.peersPath(),
 	}
 	// initialize the peer server for network communication
-	peerServer = peer.NewPeerServer(peerConfig, &wg, chainMgr)
+	peerServer = peer.NewPeerServer(peerConfig, &wg, chainMgr, txPool)
 	peerServer.Start()
 	logger.Info("Successfully started peer server")
 
-	// initialize the mining server
+	// initialize the mining server, which can also be
+	// started and stopped through the REST API
+	miner = mining.NewMinerServer(chainMgr, txPool, &wg, miningAddr, peerServer, cfg.miningWorkers)
+	peerServer.MinerChan = miner.MinerChan
 	if cfg.miningNode {
-		miner = mining.NewMinerServer(chainMgr, &wg, w.GetInitialAddress(), peerServer)
 		miner.StartMiner()
-		peerServer.MinerChan = miner.MinerChan
 	}
 	logger.Info("Successfully started mining server")
 
 	// initialize the server that exposes the REST API
-	gcd = NewServer(cfg, chainMgr, w, miner, &wg)
+	gcd = NewServer(cfg, chainMgr, txPool, w, miner, peerServer, mockClock, &wg)
 	gcd.StartServer()
 	logger.Info("Successfully started api server")
 
-	go func() {
-		logger.Info("Reindexing UTXO Set.")
-
-		utxoSet.Reindex()
-		ctx := utxoSet.CountTransactions()
-		logger.WithDetails(
-			log.NewDetail("txcount", ctx),
-		).Info("Finished reindexing UTXO Set.")
-	}()
-
 	if serverChan != nil {
 		serverChan <- gcd
 	}
-	// Enter an infinite select, the daemon is still stoppable
-	// due to the goroutine checking for a sigterm
-	select {}
+	// Wait for a signal to terminate, abandoning the search
+	// for a block before leaving
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	logger.Info("Catching signal, terminating gracefully.")
+
+	// Stop the components feeding on the chain before closing it,
+	// letting the requests and connections being handled finish
+	miner.StopMiner()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = gcd.StopServer(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Failed to stop api server")
+	}
+	peerServer.Stop()
+
+	wg.Wait()
+	logger.Info("Stopped all servers")
 
+	return chain.Close()
 }
 
 // Main is the entrypoint for the Gophercoin Daemon
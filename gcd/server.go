@@ -1,9 +1,12 @@
 package gcd
 
 import (
+	"context"
+
 	"github.com/murlokito/gophercoin/api"
 	"github.com/murlokito/gophercoin/blockchain"
 	"github.com/murlokito/gophercoin/log"
+	"github.com/murlokito/gophercoin/mempool"
 	"github.com/murlokito/gophercoin/mining"
 	"github.com/murlokito/gophercoin/peer"
 	"github.com/murlokito/gophercoin/wallet"
@@ -14,12 +17,17 @@ import (
 type Server struct {
 	cfg          *Config
 	chainMgr     *blockchain.ChainManager
+	txPool       *mempool.TxPool
 	peerServer   *peer.PeerServer
 	miner        *mining.MinerServer
 	wallet       *wallet.Wallet
 	wg           *sync.WaitGroup
 	api          *api.APIServer
 	nodeServChan chan interface{}
+
+	// mockClock controls the time of the node on
+	// networks generating blocks, nil on the others
+	mockClock *blockchain.MockClock
 }
 
 // StartServer is the function used to start the gophercoind Server
@@ -36,6 +44,16 @@ func (s *Server) StartServer() {
 	s.api = api
 }
 
+// StopServer stops the server exposing the REST API, waiting for the
+// requests being handled until the context is done
+func (s *Server) StopServer(ctx context.Context) error {
+	if s.api == nil {
+		return nil
+	}
+
+	return s.api.Stop(ctx)
+}
+
 // Routes returns the API routes exposed to interact with the node
 func (s *Server) Routes() api.Routes {
 	return api.Routes{
@@ -69,12 +87,30 @@ func (s *Server) Routes() api.Routes {
 			Pattern:     "/generate_blocks/{Amount}",
 			HandlerFunc: s.GenerateBlocks,
 		},
+		api.Route{
+			Name:        "GenerateToAddress",
+			Method:      "POST",
+			Pattern:     "/generate_to_address/{Amount}/{Address}",
+			HandlerFunc: s.GenerateToAddress,
+		},
+		api.Route{
+			Name:        "SetMockTime",
+			Method:      "POST",
+			Pattern:     "/set_mock_time/{Timestamp}",
+			HandlerFunc: s.SetMockTime,
+		},
 		api.Route{
 			Name:        "GetBalance",
 			Method:      "GET",
 			Pattern:     "/get_balance/{Address}",
 			HandlerFunc: s.GetBalance,
 		},
+		api.Route{
+			Name:        "GetHistory",
+			Method:      "GET",
+			Pattern:     "/get_history/{Address}/{Skip}/{Count}",
+			HandlerFunc: s.GetHistory,
+		},
 		api.Route{
 			Name:        "ListAddresses",
 			Method:      "GET",
@@ -93,6 +129,54 @@ func (s *Server) Routes() api.Routes {
 			Pattern:     "/list_blocks",
 			HandlerFunc: s.ListBlocks,
 		},
+		api.Route{
+			Name:        "GetBlockByHeight",
+			Method:      "GET",
+			Pattern:     "/get_block/{Height}",
+			HandlerFunc: s.GetBlockByHeight,
+		},
+		api.Route{
+			Name:        "GetMerkleProof",
+			Method:      "GET",
+			Pattern:     "/get_merkle_proof/{BlockHash}/{TxID}",
+			HandlerFunc: s.GetMerkleProof,
+		},
+		api.Route{
+			Name:        "GetBlockTemplate",
+			Method:      "GET",
+			Pattern:     "/get_block_template",
+			HandlerFunc: s.GetBlockTemplate,
+		},
+		api.Route{
+			Name:        "SubmitBlock",
+			Method:      "POST",
+			Pattern:     "/submit_block",
+			HandlerFunc: s.SubmitBlock,
+		},
+		api.Route{
+			Name:        "MiningInfo",
+			Method:      "GET",
+			Pattern:     "/mining_info",
+			HandlerFunc: s.MiningInfo,
+		},
+		api.Route{
+			Name:        "StartMining",
+			Method:      "POST",
+			Pattern:     "/start_mining",
+			HandlerFunc: s.StartMining,
+		},
+		api.Route{
+			Name:        "StopMining",
+			Method:      "POST",
+			Pattern:     "/stop_mining",
+			HandlerFunc: s.StopMining,
+		},
+		api.Route{
+			Name:        "SetMiningAddress",
+			Method:      "POST",
+			Pattern:     "/set_mining_address/{Address}",
+			HandlerFunc: s.SetMiningAddress,
+		},
 		api.Route{
 			Name:        "NodeInfo",
 			Method:      "GET",
@@ -115,12 +199,15 @@ func (s *Server) Routes() api.Routes {
 }
 
 // NewServer creates a new server with all the needed components
-func NewServer(config *Config, chainMgr *blockchain.ChainManager, wallet *wallet.Wallet, miner *mining.MinerServer, wg *sync.WaitGroup) *Server {
+func NewServer(config *Config, chainMgr *blockchain.ChainManager, txPool *mempool.TxPool, wallet *wallet.Wallet, miner *mining.MinerServer, peerServer *peer.PeerServer, mockClock *blockchain.MockClock, wg *sync.WaitGroup) *Server {
 	return &Server{
 		cfg:          config,
 		chainMgr:     chainMgr,
+		txPool:       txPool,
 		wallet:       wallet,
 		miner:        miner,
+		peerServer:   peerServer,
+		mockClock:    mockClock,
 		wg:           wg,
 		nodeServChan: make(chan interface{}),
 	}
@@ -1,9 +1,13 @@
 package log
 
 import (
+	"io"
 	"os"
 )
 
+// output is where the loggers created by NewLogger write
+var output io.Writer = os.Stdout
+
 // Logger interface of a Log. Useful for mocks and generic logs
 type Logger interface {
 	WithError(err error) Logger
@@ -13,10 +17,22 @@ type Logger interface {
 	Error(format string, args ...interface{})
 }
 
+// SetOutput sets where the loggers created from now
+// on by NewLogger write, os.Stdout by default
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	output = w
+}
+
 // NewLogger returns a new Logger
 func NewLogger(level Level) Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
 	return New(Conf{
-		Writer: os.Stdout,
+		Writer: output,
 		Level:  level,
 	})
 }
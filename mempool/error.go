@@ -0,0 +1,73 @@
+package mempool
+
+import "fmt"
+
+// ErrorCode identifies the policy rule a transaction violates
+type ErrorCode int
+
+// These constants are used to identify a specific RuleError
+const (
+	// ErrDuplicate indicates a transaction is already in the pool
+	ErrDuplicate ErrorCode = iota
+
+	// ErrCoinbase indicates a transaction is a coinbase, which
+	// only exists as the first transaction of a block
+	ErrCoinbase
+
+	// ErrTxTooBig indicates a transaction is larger than the policy allows
+	ErrTxTooBig
+
+	// ErrDust indicates a transaction has an output worth less
+	// than the fee it would take to spend it
+	ErrDust
+
+	// ErrDoubleSpend indicates a transaction spends an output
+	// already spent by a transaction of the pool
+	ErrDoubleSpend
+
+	// ErrInsufficientFee indicates a transaction pays less
+	// than the minimum fee for its size
+	ErrInsufficientFee
+
+	// ErrPoolFull indicates a transaction was evicted as soon as it
+	// was added, its fee rate being the lowest of the full pool
+	ErrPoolFull
+)
+
+// Map of ErrorCode values back to their constant names for pretty printing
+var errorCodeStrings = map[ErrorCode]string{
+	ErrDuplicate:       "ErrDuplicate",
+	ErrCoinbase:        "ErrCoinbase",
+	ErrTxTooBig:        "ErrTxTooBig",
+	ErrDust:            "ErrDust",
+	ErrDoubleSpend:     "ErrDoubleSpend",
+	ErrInsufficientFee: "ErrInsufficientFee",
+	ErrPoolFull:        "ErrPoolFull",
+}
+
+// String returns the ErrorCode as a human-readable name
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// RuleError identifies a transaction rejected by the policy of the pool.
+// Transactions violating the consensus rules are rejected with the
+// blockchain.RuleError of the rule instead.
+type RuleError struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+// ruleError creates a RuleError given a set of arguments
+func ruleError(c ErrorCode, desc string) RuleError {
+	return RuleError{ErrorCode: c, Description: desc}
+}
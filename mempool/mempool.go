@@ -0,0 +1,557 @@
+package mempool
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/log"
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+// rollingFeeHalfLife is how long it takes the minimum fee rate raised
+// by evictions to decay by half
+const rollingFeeHalfLife = 12 * time.Hour
+
+// TxDesc describes a transaction of the pool
+type TxDesc struct {
+	Tx *transaction.Transaction
+
+	// Added is when the transaction was added to the pool, in the
+	// network-adjusted time of the chain
+	Added time.Time
+
+	// seq is the order in which the transaction was added, as
+	// transactions added in the same second share the same time
+	seq uint64
+
+	// Fee is the value of its inputs minus the value of its outputs
+	Fee int
+
+	// Size is the size in bytes of the serialized transaction
+	Size int
+
+	// descendantFee and descendantSize are the sums of the fees and
+	// sizes of the transaction and of the transactions of the pool
+	// depending on it, directly or not, kept up to date as transactions
+	// are added and removed so packages are ranked without walking them
+	descendantFee  int
+	descendantSize int
+}
+
+// TxPool holds the valid transactions waiting to be mined. It is safe
+// for concurrent access. Transactions are only accepted after passing
+// the consensus rules and the policy of the pool, and are removed once
+// they, or transactions conflicting with them, are mined.
+type TxPool struct {
+	policy   Policy
+	chainMgr *blockchain.ChainManager
+	logger   log.Logger
+
+	mutex   sync.RWMutex
+	pool    map[string]*TxDesc
+	nextSeq uint64
+
+	// size is the sum of the sizes of the transactions of the pool
+	size int
+
+	// rollingFeeRate is the minimum fee rate per 1000 bytes raised by
+	// the evictions of a full pool, decaying back to the rate of the
+	// policy from lastRollingFeeUpdate on
+	rollingFeeRate       float64
+	lastRollingFeeUpdate time.Time
+
+	// outpoints maps the outputs spent by the transactions
+	// of the pool to the transaction spending them
+	outpoints map[string]*transaction.Transaction
+
+	// disconnected holds the transactions of disconnected blocks the
+	// pool rejected. The blocks of a reorganization are disconnected
+	// from the tip down, so a transaction may only become valid once
+	// the block holding its parent is disconnected as well. They are
+	// retried after each disconnected block until a block is connected.
+	disconnected []*transaction.Transaction
+}
+
+// outpointKey returns the key identifying the output of a transaction
+func outpointKey(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
+
+// New creates an empty pool checking transactions against the chain of
+// the ChainManager with the given policy. The pool is only kept in sync
+// with the chain once it is set as the TxSource of the ChainManager.
+func New(policy Policy, chainMgr *blockchain.ChainManager) *TxPool {
+	return &TxPool{
+		policy:    policy,
+		chainMgr:  chainMgr,
+		logger:    log.NewLogger(log.InfoLevel),
+		pool:      make(map[string]*TxDesc),
+		outpoints: make(map[string]*transaction.Transaction),
+	}
+}
+
+// Policy returns the policy of the pool
+func (p *TxPool) Policy() Policy {
+	return p.policy
+}
+
+// now returns the network-adjusted time of the chain, which follows
+// the mock clock on networks generating blocks on demand
+func (p *TxPool) now() time.Time {
+	return p.chainMgr.TimeSource.AdjustedTime()
+}
+
+// minFeeRate returns the minimum fee rate per 1000 bytes of the pool,
+// the rate of the policy unless evictions raised it. The raised rate
+// halves every rollingFeeHalfLife and is dropped once below half the
+// rate of the policy. The pool lock must be held.
+func (p *TxPool) minFeeRate(now time.Time) int {
+	if p.rollingFeeRate > 0 {
+		elapsed := now.Sub(p.lastRollingFeeUpdate)
+		if elapsed > 0 {
+			p.rollingFeeRate /= math.Pow(2, float64(elapsed)/float64(rollingFeeHalfLife))
+			p.lastRollingFeeUpdate = now
+		}
+
+		if p.rollingFeeRate < math.Max(float64(p.policy.MinRelayTxFee), 1)/2 {
+			p.rollingFeeRate = 0
+		}
+	}
+
+	rate := int(math.Ceil(p.rollingFeeRate))
+	if rate < p.policy.MinRelayTxFee {
+		rate = p.policy.MinRelayTxFee
+	}
+
+	return rate
+}
+
+// MinRequiredFee returns the minimum fee a transaction of the given size
+// must currently pay to be accepted, which rises above the one of the
+// policy while the pool is full
+func (p *TxPool) MinRequiredFee(size int) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return calcMinFee(size, p.minFeeRate(p.now()))
+}
+
+// ProcessTransaction checks the transaction against the consensus rules
+// and the policy of the pool and adds it to the pool if it passes them.
+// Its inputs may spend outputs of the UTXO set or of transactions of the
+// pool, but no output already spent by a transaction of the pool. The
+// expired transactions are removed first.
+func (p *TxPool) ProcessTransaction(tx *transaction.Transaction) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	p.expireTransactions(now)
+
+	return p.maybeAcceptTransaction(tx, now)
+}
+
+// maybeAcceptTransaction adds the transaction to the pool if it is
+// valid, evicting the packages paying the lowest fee rates if the pool
+// outgrows its maximum size. The pool lock must be held.
+func (p *TxPool) maybeAcceptTransaction(tx *transaction.Transaction, now time.Time) error {
+	chain := p.chainMgr.Chain
+	if chain == nil {
+		return errors.New("no blockchain to check the transaction against")
+	}
+
+	id := hex.EncodeToString(tx.ID)
+	if _, exists := p.pool[id]; exists {
+		return ruleError(ErrDuplicate, fmt.Sprintf("transaction %x is already in the pool", tx.ID))
+	}
+
+	err := blockchain.CheckTransactionSanity(tx)
+	if err != nil {
+		return err
+	}
+
+	if tx.IsCoinbase() {
+		return ruleError(ErrCoinbase, fmt.Sprintf("transaction %x is a coinbase", tx.ID))
+	}
+
+	size := len(tx.Serialize())
+	if size > p.policy.MaxTxSize {
+		return ruleError(ErrTxTooBig, fmt.Sprintf("transaction %x is %d bytes, more than the maximum of %d",
+			tx.ID, size, p.policy.MaxTxSize))
+	}
+
+	for i := range tx.Vout {
+		if p.policy.IsDust(&tx.Vout[i]) {
+			return ruleError(ErrDust, fmt.Sprintf("output %d of transaction %x is dust", i, tx.ID))
+		}
+	}
+
+	// The inputs spend either unspent outputs or outputs of
+	// transactions of the pool, never ones spent in the pool
+	var parents []*transaction.Transaction
+	for _, vin := range tx.Vin {
+		key := outpointKey(vin.Txid, vin.Vout)
+		if spender, exists := p.outpoints[key]; exists {
+			return ruleError(ErrDoubleSpend, fmt.Sprintf("output %s spent by transaction %x is already spent by transaction %x",
+				key, tx.ID, spender.ID))
+		}
+
+		if parent, exists := p.pool[hex.EncodeToString(vin.Txid)]; exists {
+			parents = append(parents, parent.Tx)
+		}
+	}
+
+	fee, err := chain.CheckTransactionInputs(tx, parents)
+	if err != nil {
+		return err
+	}
+
+	minFee := calcMinFee(size, p.minFeeRate(now))
+	if fee < minFee {
+		return ruleError(ErrInsufficientFee, fmt.Sprintf("transaction %x pays a fee of %d, less than the minimum of %d",
+			tx.ID, fee, minFee))
+	}
+
+	p.pool[id] = &TxDesc{
+		Tx:             tx,
+		Added:          now,
+		Fee:            fee,
+		Size:           size,
+		seq:            p.nextSeq,
+		descendantFee:  fee,
+		descendantSize: size,
+	}
+	p.nextSeq++
+	for _, ancestor := range p.ancestors(tx) {
+		ancestor.descendantFee += fee
+		ancestor.descendantSize += size
+	}
+	p.size += size
+	for _, vin := range tx.Vin {
+		p.outpoints[outpointKey(vin.Txid, vin.Vout)] = tx
+	}
+
+	p.trimToSize(now)
+	if _, exists := p.pool[id]; !exists {
+		return ruleError(ErrPoolFull, fmt.Sprintf("transaction %x pays the lowest fee rate of the full pool", tx.ID))
+	}
+	p.logger.Info("Accepted transaction %x into the pool, %d transactions", tx.ID, len(p.pool))
+
+	return nil
+}
+
+// txPackage returns the transaction described along with the transactions
+// of the pool depending on it, directly or not, the transaction first.
+// The pool lock must be held.
+func (p *TxPool) txPackage(desc *TxDesc) []*TxDesc {
+	pkg := []*TxDesc{desc}
+	seen := map[string]struct{}{hex.EncodeToString(desc.Tx.ID): {}}
+
+	for i := 0; i < len(pkg); i++ {
+		tx := pkg[i].Tx
+		for vout := range tx.Vout {
+			redeemer, exists := p.outpoints[outpointKey(tx.ID, vout)]
+			if !exists {
+				continue
+			}
+
+			id := hex.EncodeToString(redeemer.ID)
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			pkg = append(pkg, p.pool[id])
+		}
+	}
+
+	return pkg
+}
+
+// ancestors returns the transactions of the pool the transaction
+// depends on, directly or not, each only once. The pool lock must be held.
+func (p *TxPool) ancestors(tx *transaction.Transaction) []*TxDesc {
+	var ancestors []*TxDesc
+	seen := make(map[string]struct{})
+
+	txs := []*transaction.Transaction{tx}
+	for i := 0; i < len(txs); i++ {
+		for _, vin := range txs[i].Vin {
+			id := hex.EncodeToString(vin.Txid)
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			if parent, exists := p.pool[id]; exists {
+				ancestors = append(ancestors, parent)
+				txs = append(txs, parent.Tx)
+			}
+		}
+	}
+
+	return ancestors
+}
+
+// evictPackage removes the transactions of the package from the pool,
+// logging each of them with the reason of the eviction. The pool lock
+// must be held.
+func (p *TxPool) evictPackage(pkg []*TxDesc, reason string) {
+	// The transactions depending on the first one are removed
+	// before it, keeping the totals of its ancestors right
+	p.removeTransaction(pkg[0].Tx, true)
+
+	for _, desc := range pkg {
+		p.logger.WithDetails(
+			log.NewDetail("txid", hex.EncodeToString(desc.Tx.ID)),
+			log.NewDetail("fee", desc.Fee),
+			log.NewDetail("size", desc.Size),
+			log.NewDetail("added", desc.Added.Unix()),
+		).Info("Evicted transaction from the pool: %s", reason)
+	}
+}
+
+// trimToSize evicts the packages paying the lowest fee rates until the
+// pool fits in its maximum size. The minimum fee rate of the pool is
+// raised above the rate of each evicted package, so the transactions
+// accepted next pay more than the ones evicted. The pool lock must be held.
+func (p *TxPool) trimToSize(now time.Time) {
+	for p.size > p.policy.MaxPoolSize {
+		var lowest *TxDesc
+		for _, desc := range p.pool {
+			// Compare the fee rates without dividing, ties
+			// broken by ID for the eviction to be deterministic
+			fee, size := desc.descendantFee, desc.descendantSize
+			lower := lowest == nil || fee*lowest.descendantSize < lowest.descendantFee*size ||
+				(fee*lowest.descendantSize == lowest.descendantFee*size && bytes.Compare(desc.Tx.ID, lowest.Tx.ID) < 0)
+			if lower {
+				lowest = desc
+			}
+		}
+		lowestFee, lowestSize := lowest.descendantFee, lowest.descendantSize
+
+		rate := float64(lowestFee) * 1000 / float64(lowestSize)
+		p.evictPackage(p.txPackage(lowest), fmt.Sprintf("pool full, package fee rate %.2f per 1000 bytes", rate))
+
+		// The new rate must beat the evicted one by the rate of the policy
+		rate += float64(p.policy.MinRelayTxFee)
+		if rate > float64(p.minFeeRate(now)) {
+			p.rollingFeeRate = rate
+			p.lastRollingFeeUpdate = now
+			p.logger.Info("Raised the minimum fee rate of the pool to %.2f per 1000 bytes", rate)
+		}
+	}
+}
+
+// expireTransactions evicts the transactions added to the pool longer
+// than the expiry of the policy ago, along with the transactions
+// depending on them. The pool lock must be held.
+func (p *TxPool) expireTransactions(now time.Time) {
+	for _, desc := range p.pool {
+		if now.Sub(desc.Added) > p.policy.Expiry {
+			p.evictPackage(p.txPackage(desc), "expired")
+		}
+	}
+}
+
+// removeTransaction removes the transaction from the pool, along with the
+// transactions spending its outputs when removeRedeemers is true. The
+// pool lock must be held.
+func (p *TxPool) removeTransaction(tx *transaction.Transaction, removeRedeemers bool) {
+	if removeRedeemers {
+		for vout := range tx.Vout {
+			if redeemer, exists := p.outpoints[outpointKey(tx.ID, vout)]; exists {
+				p.removeTransaction(redeemer, true)
+			}
+		}
+	}
+
+	id := hex.EncodeToString(tx.ID)
+	desc, exists := p.pool[id]
+	if !exists {
+		return
+	}
+
+	for _, ancestor := range p.ancestors(desc.Tx) {
+		ancestor.descendantFee -= desc.Fee
+		ancestor.descendantSize -= desc.Size
+	}
+	for _, vin := range desc.Tx.Vin {
+		delete(p.outpoints, outpointKey(vin.Txid, vin.Vout))
+	}
+	delete(p.pool, id)
+	p.size -= desc.Size
+}
+
+// RemoveTransaction removes the transaction from the pool, along with the
+// transactions spending its outputs when removeRedeemers is true
+func (p *TxPool) RemoveTransaction(tx *transaction.Transaction, removeRedeemers bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.removeTransaction(tx, removeRedeemers)
+}
+
+// removeDoubleSpends removes the transactions of the pool spending the
+// outputs the transaction spends, other than the transaction itself, and
+// the ones depending on them. The pool lock must be held.
+func (p *TxPool) removeDoubleSpends(tx *transaction.Transaction) {
+	for _, vin := range tx.Vin {
+		spender, exists := p.outpoints[outpointKey(vin.Txid, vin.Vout)]
+		if exists && !bytes.Equal(spender.ID, tx.ID) {
+			p.removeTransaction(spender, true)
+		}
+	}
+}
+
+// HandleNotification keeps the pool in sync with the main chain.
+// Transactions included in connected blocks are removed, so are the
+// ones conflicting with them, the ones depending on those and the
+// expired ones, while the transactions of disconnected blocks are put
+// back into the pool, the ones rejected being dropped once a block is
+// connected.
+func (p *TxPool) HandleNotification(n *blockchain.Notification) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	switch n.Type {
+	case blockchain.NTBlockConnected:
+		for _, tx := range n.Block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			p.removeTransaction(tx, false)
+			p.removeDoubleSpends(tx)
+		}
+		p.dropDisconnected(n.Block)
+		p.expireTransactions(now)
+
+	case blockchain.NTBlockDisconnected:
+		for _, tx := range n.Block.Transactions {
+			if !tx.IsCoinbase() {
+				p.disconnected = append(p.disconnected, tx)
+			}
+		}
+		p.acceptDisconnected(now)
+	}
+}
+
+// acceptDisconnected puts the transactions of the disconnected blocks
+// back into the pool, retrying the rejected ones as long as others are
+// accepted as they may spend their outputs. The pool lock must be held.
+func (p *TxPool) acceptDisconnected(now time.Time) {
+	for accepted := true; accepted; {
+		accepted = false
+
+		var rejected []*transaction.Transaction
+		for _, tx := range p.disconnected {
+			if _, exists := p.pool[hex.EncodeToString(tx.ID)]; exists {
+				continue
+			}
+
+			if err := p.maybeAcceptTransaction(tx, now); err != nil {
+				rejected = append(rejected, tx)
+				continue
+			}
+			accepted = true
+		}
+		p.disconnected = rejected
+	}
+}
+
+// dropDisconnected drops the transactions of disconnected blocks the
+// pool rejected, other than the ones included in the connected block,
+// along with the transactions of the pool spending their outputs. The
+// pool lock must be held.
+func (p *TxPool) dropDisconnected(connected *blockchain.Block) {
+	mined := make(map[string]struct{})
+	for _, tx := range connected.Transactions {
+		mined[hex.EncodeToString(tx.ID)] = struct{}{}
+	}
+
+	for _, tx := range p.disconnected {
+		if _, ok := mined[hex.EncodeToString(tx.ID)]; ok {
+			continue
+		}
+
+		p.removeTransaction(tx, true)
+		p.logger.Error("Dropped transaction %x of disconnected block", tx.ID)
+	}
+	p.disconnected = nil
+}
+
+// HaveTransaction returns whether the transaction is in the pool
+func (p *TxPool) HaveTransaction(id []byte) bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	_, exists := p.pool[hex.EncodeToString(id)]
+	return exists
+}
+
+// FetchTransaction returns the transaction of the pool with the given ID
+func (p *TxPool) FetchTransaction(id []byte) (*transaction.Transaction, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	desc, exists := p.pool[hex.EncodeToString(id)]
+	if !exists {
+		return nil, fmt.Errorf("transaction %x is not in the pool", id)
+	}
+
+	return desc.Tx, nil
+}
+
+// Count returns the number of transactions in the pool
+func (p *TxPool) Count() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return len(p.pool)
+}
+
+// Size returns the sum of the sizes in bytes of the transactions of the pool
+func (p *TxPool) Size() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.size
+}
+
+// TxDescs returns the descriptions of the transactions of the pool,
+// oldest first
+func (p *TxPool) TxDescs() []*TxDesc {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	descs := make([]*TxDesc, 0, len(p.pool))
+	for _, desc := range p.pool {
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].seq < descs[j].seq
+	})
+
+	return descs
+}
+
+// MiningTxs returns the transactions of the pool, implementing
+// blockchain.TxSource so blocks can be built from them
+func (p *TxPool) MiningTxs() []*transaction.Transaction {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	txs := make([]*transaction.Transaction, 0, len(p.pool))
+	for _, desc := range p.pool {
+		txs = append(txs, desc.Tx)
+	}
+
+	return txs
+}
@@ -0,0 +1,310 @@
+package mempool
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedSpend returns a transaction spending the first output of prev,
+// owned by a, and paying value back to a
+func signedSpend(t *testing.T, a *address.Address, prev *transaction.Transaction, value int) *transaction.Transaction {
+	tx := &transaction.Transaction{
+		Vin:  []transaction.TXInput{{Txid: prev.ID, Vout: 0, PubKey: a.PublicKey}},
+		Vout: []transaction.TXOutput{{Value: value, PubKeyHash: address.HashPubKey(a.PublicKey)}},
+	}
+	tx.ID = tx.Hash()
+	err := tx.Sign(a.PrivateKey, map[string]transaction.Transaction{hex.EncodeToString(prev.ID): *prev})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+// errorCode returns the code of the RuleError, -1 for other errors
+func errorCode(err error) ErrorCode {
+	if rerr, ok := err.(RuleError); ok {
+		return rerr.ErrorCode
+	}
+
+	return -1
+}
+
+// TestProcessTransaction checks the pool accepts valid transactions,
+// rejects the ones breaking its policy and stays in sync with the chain
+func TestProcessTransaction(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := blockchain.CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainMgr := blockchain.NewChainManager(bc, nil)
+	pool := New(DefaultPolicy(), chainMgr)
+	chainMgr.TxSource = pool
+
+	var coinbases []*transaction.Transaction
+	for height := 1; height <= 2; height++ {
+		block, err := bc.MineBlock([]*transaction.Transaction{
+			transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(height, params)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbases = append(coinbases, block.Transactions[0])
+	}
+	value := coinbases[0].Vout[0].Value
+
+	parent := signedSpend(t, a, coinbases[0], value-1)
+	assert.NoError(t, pool.ProcessTransaction(parent))
+	assert.Equal(t, ErrDuplicate, errorCode(pool.ProcessTransaction(parent)))
+
+	conflict := signedSpend(t, a, coinbases[0], value-2)
+	assert.Equal(t, ErrDoubleSpend, errorCode(pool.ProcessTransaction(conflict)))
+
+	noFee := signedSpend(t, a, coinbases[1], value)
+	assert.Equal(t, ErrInsufficientFee, errorCode(pool.ProcessTransaction(noFee)))
+
+	dust := signedSpend(t, a, coinbases[1], 0)
+	assert.Equal(t, ErrDust, errorCode(pool.ProcessTransaction(dust)))
+
+	// Outputs of the transactions of the pool can be spent
+	child := signedSpend(t, a, parent, value-3)
+	assert.NoError(t, pool.ProcessTransaction(child))
+	other := signedSpend(t, a, coinbases[1], value-1)
+	assert.NoError(t, pool.ProcessTransaction(other))
+	assert.Equal(t, 3, pool.Count())
+
+	desc := pool.TxDescs()[0]
+	assert.Equal(t, parent, desc.Tx)
+	assert.Equal(t, 1, desc.Fee)
+	assert.Equal(t, len(parent.Serialize()), desc.Size)
+
+	// A block spending the output spent by parent removes parent and
+	// its child, while the transaction it includes leaves the pool
+	mined := signedSpend(t, a, coinbases[0], value-3)
+	_, err = bc.MineBlock([]*transaction.Transaction{
+		transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(3, params)+3+1),
+		mined,
+		other,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, pool.Count())
+	assert.False(t, pool.HaveTransaction(parent.ID))
+	assert.False(t, pool.HaveTransaction(child.ID))
+	assert.False(t, pool.HaveTransaction(other.ID))
+	assert.Empty(t, pool.outpoints)
+}
+
+// TestEvictionAndExpiry checks a full pool evicts the transactions paying
+// the lowest fee rate, raising its minimum fee until it decays, and that
+// transactions expire
+func TestEvictionAndExpiry(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := blockchain.CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainMgr := blockchain.NewChainManager(bc, nil)
+
+	var coinbases []*transaction.Transaction
+	for height := 1; height <= 4; height++ {
+		block, err := bc.MineBlock([]*transaction.Transaction{
+			transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(height, params)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbases = append(coinbases, block.Transactions[0])
+	}
+	value := coinbases[0].Vout[0].Value
+
+	clock := blockchain.NewMockClock()
+	start := time.Unix(time.Now().Unix(), 0)
+	clock.SetMockTime(start)
+	chainMgr.SetTimeSource(blockchain.NewMedianTime(clock))
+
+	low := signedSpend(t, a, coinbases[0], value-1)
+	high := signedSpend(t, a, coinbases[1], value-3)
+	mid := signedSpend(t, a, coinbases[2], value-2)
+	size := len(low.Serialize())
+
+	policy := DefaultPolicy()
+	policy.MaxPoolSize = 2*size + size/2
+	policy.Expiry = 72 * time.Hour
+	pool := New(policy, chainMgr)
+	chainMgr.TxSource = pool
+
+	assert.NoError(t, pool.ProcessTransaction(low))
+	assert.NoError(t, pool.ProcessTransaction(high))
+	assert.NoError(t, pool.ProcessTransaction(mid))
+	assert.False(t, pool.HaveTransaction(low.ID), "Lowest fee rate evicted")
+	assert.Equal(t, 2, pool.Count())
+	assert.Equal(t, len(high.Serialize())+len(mid.Serialize()), pool.Size())
+
+	// The evicted fee rate is no longer enough
+	assert.True(t, pool.MinRequiredFee(size) > policy.MinRequiredFee(size))
+	assert.Equal(t, ErrInsufficientFee, errorCode(pool.ProcessTransaction(low)))
+
+	// Once the minimum fee decayed the transaction is accepted, but
+	// evicted right away as it pays the lowest fee rate
+	clock.SetMockTime(start.Add(48 * time.Hour))
+	assert.Equal(t, policy.MinRequiredFee(size), pool.MinRequiredFee(size))
+	assert.Equal(t, ErrPoolFull, errorCode(pool.ProcessTransaction(low)))
+	assert.Equal(t, 2, pool.Count())
+
+	// Adding a transaction after the expiry removes the old ones
+	clock.SetMockTime(start.Add(73 * time.Hour))
+	fresh := signedSpend(t, a, coinbases[3], value-3)
+	assert.NoError(t, pool.ProcessTransaction(fresh))
+	assert.Equal(t, 1, pool.Count())
+	assert.True(t, pool.HaveTransaction(fresh.ID))
+	assert.Equal(t, len(fresh.Serialize()), pool.Size())
+}
+
+// TestReorganization checks the transactions of the blocks disconnected
+// by a reorganization are put back into the pool, even when a block
+// disconnected first spends the outputs of one disconnected next, and
+// that the ones conflicted by the new branch are dropped along with
+// the transactions of the pool spending their outputs
+func TestReorganization(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	for _, conflicted := range []bool{false, true} {
+		bc, err := blockchain.CreateBlockchainWithDB(database.NewMemory(), params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chainMgr := blockchain.NewChainManager(bc, nil)
+		pool := New(DefaultPolicy(), chainMgr)
+		chainMgr.TxSource = pool
+
+		fork, err := bc.MineBlock([]*transaction.Transaction{
+			transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(1, params)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := fork.Transactions[0].Vout[0].Value
+
+		// The parent and its child are mined in consecutive blocks,
+		// the grandchild waits in the pool
+		parent := signedSpend(t, a, fork.Transactions[0], value-1)
+		child := signedSpend(t, a, parent, value-2)
+		for i, tx := range []*transaction.Transaction{parent, child} {
+			_, err := bc.MineBlock([]*transaction.Transaction{
+				transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(i+2, params)+1),
+				tx,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		grandchild := signedSpend(t, a, child, value-3)
+		assert.NoError(t, pool.ProcessTransaction(grandchild))
+
+		// A longer branch from the first block disconnects both,
+		// spending the output spent by the parent when conflicted
+		prev := fork
+		for height := 2; height <= 4; height++ {
+			txs := []*transaction.Transaction{
+				transaction.NewCoinbaseTX(addr, fmt.Sprintf("side %d", height), blockchain.CalcBlockSubsidy(height, params)),
+			}
+			if conflicted && height == 2 {
+				txs = append(txs, signedSpend(t, a, fork.Transactions[0], value))
+			}
+			block := blockchain.NewBlock(prev.Hash, txs, height, params.PowLimitBits, prev.Timestamp+1)
+			_, err := bc.ProcessBlock(block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prev = block
+		}
+		assert.Equal(t, prev.Hash, bc.Tip)
+		assert.Empty(t, pool.disconnected)
+
+		if conflicted {
+			assert.Equal(t, 0, pool.Count())
+			assert.False(t, pool.HaveTransaction(grandchild.ID), "Transaction spending a dropped one is removed")
+			assert.Empty(t, pool.outpoints)
+			continue
+		}
+
+		assert.Equal(t, 3, pool.Count())
+		assert.True(t, pool.HaveTransaction(parent.ID))
+		assert.True(t, pool.HaveTransaction(child.ID), "Child is put back once its parent is")
+		assert.True(t, pool.HaveTransaction(grandchild.ID))
+	}
+}
+
+// TestDescendantTotals checks the fees and sizes of the descendants of
+// the transactions of the pool follow the transactions added and removed
+func TestDescendantTotals(t *testing.T) {
+	params := new(chaincfg.Params)
+	*params = chaincfg.RegressionNetParams
+	params.CoinbaseMaturity = 1
+	a := address.NewAddress()
+	addr := string(a.GetAddress(params.AddressVersion))
+
+	bc, err := blockchain.CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainMgr := blockchain.NewChainManager(bc, nil)
+	pool := New(DefaultPolicy(), chainMgr)
+	chainMgr.TxSource = pool
+
+	block, err := bc.MineBlock([]*transaction.Transaction{
+		transaction.NewCoinbaseTX(addr, "", blockchain.CalcBlockSubsidy(1, params)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := block.Transactions[0].Vout[0].Value
+
+	parent := signedSpend(t, a, block.Transactions[0], value-1)
+	child := signedSpend(t, a, parent, value-3)
+	grandchild := signedSpend(t, a, child, value-6)
+	for _, tx := range []*transaction.Transaction{parent, child, grandchild} {
+		assert.NoError(t, pool.ProcessTransaction(tx))
+	}
+
+	descs := pool.TxDescs()
+	for i, fee := range []int{6, 5, 3} {
+		size := 0
+		for _, desc := range descs[i:] {
+			size += desc.Size
+		}
+		assert.Equal(t, fee, descs[i].descendantFee)
+		assert.Equal(t, size, descs[i].descendantSize)
+	}
+
+	pool.RemoveTransaction(child, true)
+	assert.Equal(t, 1, pool.Count())
+	assert.Equal(t, 1, descs[0].descendantFee, "Removed descendants no longer count")
+	assert.Equal(t, descs[0].Size, descs[0].descendantSize)
+}
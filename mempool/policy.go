@@ -0,0 +1,78 @@
+package mempool
+
+import (
+	"time"
+
+	"github.com/murlokito/gophercoin/transaction"
+)
+
+const (
+	// DefaultMinRelayTxFee is the default minimum fee, per 1000 bytes,
+	// a transaction must pay to be accepted into the pool
+	DefaultMinRelayTxFee = 1
+
+	// DefaultMaxTxSize is the default maximum size in bytes of
+	// a transaction accepted into the pool
+	DefaultMaxTxSize = 100000
+
+	// DefaultMaxPoolSize is the default maximum size in bytes of the
+	// transactions of the pool, beyond which transactions are evicted
+	DefaultMaxPoolSize = 300 * 1000 * 1000
+
+	// DefaultExpiry is the default age after which a transaction
+	// still waiting to be mined is removed from the pool
+	DefaultExpiry = 14 * 24 * time.Hour
+
+	// inputSize is the size of an input spending an output: a 32 byte
+	// transaction ID, the index of the output, a 64 byte signature and
+	// a 64 byte public key, the byte slices prefixed by their length
+	inputSize = 1 + 32 + 4 + 1 + 64 + 1 + 64
+)
+
+// Policy holds the rules a transaction must follow to be accepted into
+// the pool, on top of the consensus rules
+type Policy struct {
+	// MinRelayTxFee is the minimum fee per 1000 bytes
+	MinRelayTxFee int
+
+	// MaxTxSize is the maximum size in bytes of a transaction
+	MaxTxSize int
+
+	// MaxPoolSize is the maximum size in bytes of the pool
+	MaxPoolSize int
+
+	// Expiry is the age after which a transaction is removed
+	Expiry time.Duration
+}
+
+// DefaultPolicy returns the policy of the pool unless configured otherwise
+func DefaultPolicy() Policy {
+	return Policy{
+		MinRelayTxFee: DefaultMinRelayTxFee,
+		MaxTxSize:     DefaultMaxTxSize,
+		MaxPoolSize:   DefaultMaxPoolSize,
+		Expiry:        DefaultExpiry,
+	}
+}
+
+// MinRequiredFee returns the minimum fee a transaction of the given size
+// must pay at the minimum relay fee of the policy. The pool may ask for
+// more while it is full, see TxPool.MinRequiredFee.
+func (p Policy) MinRequiredFee(size int) int {
+	return calcMinFee(size, p.MinRelayTxFee)
+}
+
+// calcMinFee returns the fee of a transaction of the given size at the
+// given rate per 1000 bytes, rounded up so any non-zero rate asks for a fee
+func calcMinFee(size, rate int) int {
+	return (size*rate + 999) / 1000
+}
+
+// IsDust returns whether the output is worth less than three times the
+// minimum fee of its own bytes and of the input spending it, which makes
+// spending it uneconomical
+func (p Policy) IsDust(out *transaction.TXOutput) bool {
+	size := len(out.Serialize()) + inputSize
+
+	return out.Value*1000 < 3*size*p.MinRelayTxFee
+}
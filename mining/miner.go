@@ -1,163 +1,321 @@
 package mining
 
 import (
-	"encoding/hex"
-	"github.com/murlokito/gophercoin/peer"
-	"github.com/murlokito/gophercoin/transaction"
-	"os"
+	"context"
 	"sync"
 	"time"
 
+	"github.com/murlokito/gophercoin/peer"
+	"github.com/murlokito/gophercoin/transaction"
+
 	"github.com/murlokito/gophercoin/blockchain"
 	"github.com/murlokito/gophercoin/log"
+	"github.com/murlokito/gophercoin/mempool"
+	"github.com/murlokito/gophercoin/wire"
 )
 
+const (
+	// minMempoolTxs is the number of transactions the mempool must
+	// hold for a new transaction to trigger the search for a block
+	minMempoolTxs = 3
+
+	// maxBlockInterval is how long the miner waits after the tip
+	// before searching for a block whatever the mempool holds
+	maxBlockInterval = 15 * time.Second
+
+	// tipCheckInterval is how often the age of the tip is checked
+	tipCheckInterval = time.Second
+)
+
+// MinerStats describes the state of the miner
+type MinerStats struct {
+	Mining        bool
+	Address       string
+	Workers       int
+	HashRate      float64
+	BlocksFound   int
+	LastBlockHash []byte
+	LastBlockTime time.Time
+
+	// Template is the template of the block searched for,
+	// nil when no search is running
+	Template *blockchain.BlockTemplate
+}
+
 // MinerServer is the structure which defines the
 // mining server
 type MinerServer struct {
-	MinerChan     chan []byte
-	logger        log.Logger
-	wg            *sync.WaitGroup
-	peerServer    *peer.PeerServer
-	chainMgr      *blockchain.ChainManager
-	quitChan      chan int
-	timeChan      chan int64
+	MinerChan  chan []byte
+	logger     log.Logger
+	wg         *sync.WaitGroup
+	peerServer *peer.PeerServer
+	chainMgr   *blockchain.ChainManager
+	txPool     *mempool.TxPool
+
+	// workers is the number of goroutines searching for nonces
+	workers int
+
+	// mutex guards the fields below, shared with the
+	// notifications of the chain and the API
+	mutex         sync.Mutex
 	miningAddress string
-	miningTxs     bool
+	quitChan      chan struct{}
+	doneChan      chan struct{}
+	cancel        context.CancelFunc
+	subscribed    *blockchain.Blockchain
+	template      *blockchain.BlockTemplate
+	hashRate      float64
+	blocksFound   int
+	lastBlockHash []byte
+	lastBlockTime time.Time
+}
+
+// HashRate returns the hashes per second computed by the
+// last block search
+func (s *MinerServer) HashRate() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.hashRate
+}
+
+// IsMining returns whether the miner is running
+func (s *MinerServer) IsMining() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.quitChan != nil
+}
+
+// MiningAddress returns the address the rewards of the mined blocks go to
+func (s *MinerServer) MiningAddress() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.miningAddress
+}
+
+// SetMiningAddress changes the address the rewards of the mined blocks
+// go to, starting with the next block searched for
+func (s *MinerServer) SetMiningAddress(address string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.miningAddress = address
+}
+
+// Stats returns the state of the miner
+func (s *MinerServer) Stats() MinerStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return MinerStats{
+		Mining:        s.quitChan != nil,
+		Address:       s.miningAddress,
+		Workers:       s.workers,
+		HashRate:      s.hashRate,
+		BlocksFound:   s.blocksFound,
+		LastBlockHash: s.lastBlockHash,
+		LastBlockTime: s.lastBlockTime,
+		Template:      s.template,
+	}
+}
+
+// handleNotification abandons the current block search when a block
+// is connected to the main chain, as the block searched for is stale
+func (s *MinerServer) handleNotification(n *blockchain.Notification) {
+	if n.Type != blockchain.NTBlockConnected {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
 }
 
-// StartMiner is the function used to start the gophercoin miner
+// startSearch returns the context of a new block search, cancelled
+// once a new block is connected to the main chain or the miner is
+// stopped. False is returned if the miner was stopped already.
+func (s *MinerServer) startSearch() (context.Context, context.CancelFunc, bool) {
+	chain := s.chainMgr.Chain
+
+	// Subscribe without holding the mutex, the notifications
+	// are delivered with the subscribers lock held
+	s.mutex.Lock()
+	subscribe := s.subscribed != chain
+	s.subscribed = chain
+	s.mutex.Unlock()
+	if subscribe {
+		chain.Subscribe(s.handleNotification)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.quitChan == nil {
+		cancel()
+		return nil, nil, false
+	}
+	s.cancel = cancel
+
+	return ctx, cancel, true
+}
+
+// StartMiner starts searching for blocks, it does nothing if
+// the miner is running already
 func (s *MinerServer) StartMiner() {
-	defer s.wg.Done()
-	s.logger.Info("Miner ready")
-	go s.timeAdjustment()
-	s.wg.Add(1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.quitChan != nil {
+		return
+	}
+	s.quitChan = make(chan struct{})
+	s.doneChan = make(chan struct{})
 
-	go s.Mine()
 	s.wg.Add(1)
+	go s.mine(s.quitChan, s.doneChan)
+	s.logger.Info("Miner started")
 }
 
-func (s *MinerServer) Mine() {
+// StopMiner abandons the current block search and waits for the
+// miner to stop, it does nothing if the miner is not running
+func (s *MinerServer) StopMiner() {
+	s.mutex.Lock()
+	if s.quitChan == nil {
+		s.mutex.Unlock()
+		return
+	}
+	close(s.quitChan)
+	s.quitChan = nil
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	done := s.doneChan
+	s.mutex.Unlock()
+
+	<-done
+	s.logger.Info("Miner stopped")
+}
+
+// mine searches for a block when enough transactions reach the mempool
+// or when the tip gets too old, until quit is closed. MinerChan is not
+// read while the miner is stopped, so it must be sent to without blocking.
+func (s *MinerServer) mine(quit <-chan struct{}, done chan<- struct{}) {
+	defer s.wg.Done()
+	defer close(done)
+
+	ticker := time.NewTicker(tipCheckInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-s.quitChan:
+		case <-quit:
 			s.logger.Info("Received stop signal")
-			break
+			return
+
 		case msg := <-s.MinerChan:
-			s.logger.Info("Received tx with ID %v", msg)
+			s.logger.Info("Received tx with ID %x", msg)
 
-			if len(s.chainMgr.MemPool) > 2 && !s.miningTxs {
-				s.miningTxs = true
-				t := time.Now().Unix()
+			if s.txPool.Count() >= minMempoolTxs {
 				s.mineTxs()
-				now := time.Now().Unix()
-				diff := (t - now)
-				s.logger.Info("Mined new block after %v seconds.", diff)
-				s.miningTxs = false
 			}
 
-		case msg := <-s.timeChan:
-			if msg > 15 && s.miningTxs {
-				t := time.Now().Unix()
-				s.mineTxs()
-				now := time.Now().Unix()
-				diff := (t - now)
-				s.logger.Info("Mined new block after %v seconds.", diff)
-				s.miningTxs = false
+		case <-ticker.C:
+			if s.chainMgr.Chain == nil {
+				continue
 			}
 
-		}
+			tip, err := s.chainMgr.Chain.GetBlock(s.chainMgr.Chain.Tip)
+			if err != nil {
+				s.logger.WithError(err).Error("Unable to fetch blockchain tip")
+				continue
+			}
 
+			elapsed := s.chainMgr.TimeSource.AdjustedTime().Sub(time.Unix(tip.Timestamp, 0))
+			if elapsed > maxBlockInterval {
+				s.logger.Info("Elapsed since last block: %v", elapsed)
+				s.mineTxs()
+			}
+		}
 	}
-
 }
 
 func (s *MinerServer) mineTxs() {
-	var txs []*transaction.Transaction
-	for id := range s.chainMgr.MemPool {
-		tx := s.chainMgr.MemPool[id]
-		s.logger.Info("Verifying transaction: %s\n", id)
-		if s.chainMgr.Chain.VerifyTransaction(&tx) {
-			s.logger.Info("Verified transaction: %s\n", id)
-			txs = append(txs, &tx)
-		}
+	if s.chainMgr.Chain == nil {
+		return
 	}
+	start := time.Now()
 
-	if len(txs) == 0 {
+	// The coinbase claims the subsidy and the fees of the transactions
+	template, err := s.chainMgr.NewBlockTemplate()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to build block template")
+		return
+	}
+	if len(template.Transactions) == 0 {
 		s.logger.Info("No valid transactions in mempool")
 	}
-	var cbTx *transaction.Transaction
 
-	cbTx = transaction.NewCoinbaseTX(s.miningAddress, "")
+	cbTx := transaction.NewCoinbaseTX(s.MiningAddress(), "", template.CoinbaseValue)
+	txs := append([]*transaction.Transaction{cbTx}, template.Transactions...)
 
-	txs = append(txs, cbTx)
 	s.logger.Info("Block transactions aggregated: \n%v", txs)
-	newBlock := s.chainMgr.Chain.MineBlock(txs)
-	s.logger.Info("New block is mined!")
-
-	go func() {
-		s.logger.Info("Reindexing UTXO Set.")
+	ctx, cancel, ok := s.startSearch()
+	if !ok {
+		return
+	}
+	defer cancel()
 
-		s.chainMgr.UTXOSet.Reindex()
-		ctx := s.chainMgr.UTXOSet.CountTransactions()
-		s.logger.Info("Finished reindexing UTXO Set, there are %d transactions in it.", ctx)
-	}()
+	s.mutex.Lock()
+	s.template = template
+	s.mutex.Unlock()
 
-	s.logger.Info("Reindexing UTXO Set.")
+	newBlock, stats, err := s.chainMgr.Chain.MineBlockContext(ctx, txs, s.workers)
 
-	for _, tx := range txs {
-		txID := hex.EncodeToString(tx.ID)
-		delete(s.chainMgr.MemPool, txID)
+	s.mutex.Lock()
+	s.template = nil
+	if stats.Hashes > 0 {
+		s.hashRate = stats.HashRate()
 	}
-	for _, node := range s.peerServer.KnownNodes {
-		if node.Address != s.peerServer.NodeAddress {
-			s.peerServer.SendInv(node.Address, "block", [][]byte{newBlock.Hash})
-		}
+	if err == nil {
+		s.blocksFound++
+		s.lastBlockHash = newBlock.Hash
+		s.lastBlockTime = time.Now()
 	}
-}
+	s.mutex.Unlock()
 
-func (s *MinerServer) timeAdjustment() {
-	defer s.wg.Done()
-
-	if !s.miningTxs {
-		if s.chainMgr.Chain != nil {
-			tip := s.chainMgr.Chain.Tip
-			block, err := s.chainMgr.Chain.GetBlock(tip)
-
-			if err != nil {
-				s.logger.Info("Unable to fetch blockchain tip.")
-				os.Exit(1)
-			}
-
-			now := time.Now().Unix()
-			diff := now - block.Timestamp
-
-			if diff > 15 && !s.miningTxs {
-				s.logger.Info("Elapsed since last block: %v seconds.", diff)
-				s.miningTxs = true
-				s.timeChan <- diff
-			}
+	if err == context.Canceled {
+		s.logger.Info("Block search abandoned")
+		return
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to mine block")
+		return
+	}
+	s.logger.Info("Mined new block after %v, %d hashes, %.0f hashes/s", time.Since(start), stats.Hashes, stats.HashRate())
 
+	for _, node := range s.peerServer.KnownNodes {
+		if node.Address != s.peerServer.NodeAddress {
+			s.peerServer.SendInv(node.Address, wire.InvTypeBlock, [][]byte{newBlock.Hash})
 		}
 	}
-
-	time.Sleep(1000)
-	go s.timeAdjustment()
-	s.wg.Add(1)
-
-	return
 }
 
-func NewMinerServer(chainMgr *blockchain.ChainManager, wg *sync.WaitGroup, miningAddr string, peerServer *peer.PeerServer) *MinerServer {
+func NewMinerServer(chainMgr *blockchain.ChainManager, txPool *mempool.TxPool, wg *sync.WaitGroup, miningAddr string, peerServer *peer.PeerServer, workers int) *MinerServer {
 	return &MinerServer{
 		MinerChan:     make(chan []byte, 5),
 		peerServer:    peerServer,
 		wg:            wg,
 		logger:        log.NewLogger(log.InfoLevel),
 		chainMgr:      chainMgr,
-		quitChan:      make(chan int),
-		timeChan:      make(chan int64, 5),
-		miningTxs:     false,
+		txPool:        txPool,
 		miningAddress: miningAddr,
+		workers:       workers,
 	}
 }
@@ -0,0 +1,57 @@
+package mining
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/database"
+	"github.com/murlokito/gophercoin/mempool"
+	"github.com/murlokito/gophercoin/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMinerLifecycle checks the miner mines once started, to the
+// address it is given, and stops cleanly
+func TestMinerLifecycle(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	chain, err := blockchain.CreateBlockchainWithDB(database.NewMemory(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainMgr := blockchain.NewChainManager(chain, nil)
+	txPool := mempool.New(mempool.DefaultPolicy(), chainMgr)
+	chainMgr.TxSource = txPool
+
+	var wg sync.WaitGroup
+	miner := NewMinerServer(chainMgr, txPool, &wg, "", &peer.PeerServer{}, 1)
+	addr := string(address.NewAddress().GetAddress(params.AddressVersion))
+	miner.SetMiningAddress(addr)
+	assert.False(t, miner.IsMining())
+
+	// The genesis block is old enough for the miner to start right away
+	miner.StartMiner()
+	miner.StartMiner()
+	assert.True(t, miner.IsMining())
+
+	deadline := time.Now().Add(10 * time.Second)
+	for miner.Stats().BlocksFound == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	miner.StopMiner()
+	miner.StopMiner()
+	wg.Wait()
+
+	stats := miner.Stats()
+	assert.False(t, stats.Mining)
+	assert.Equal(t, addr, stats.Address)
+	if assert.True(t, stats.BlocksFound > 0, "Miner found a block") {
+		block, err := chain.GetBlock(stats.LastBlockHash)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, block.Height)
+	}
+	assert.Nil(t, stats.Template)
+}
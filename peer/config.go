@@ -1,9 +1,21 @@
 package peer
 
-import "github.com/murlokito/gophercoin/log"
+import (
+	"github.com/murlokito/gophercoin/chaincfg"
+	"github.com/murlokito/gophercoin/log"
+)
 
 // Config holds the config necessary for the API Server
 type Config struct {
 	Port     string
 	LogLevel log.Level
+	// Params are the parameters of the network the
+	// node talks to, it ignores the other networks
+	Params *chaincfg.Params
+	// DBPath is where the chain db is created when the
+	// genesis block is received from a peer
+	DBPath string
+	// PeersFile is where the known nodes are kept across
+	// restarts, they are not saved when it is empty
+	PeersFile string
 }
@@ -1,13 +1,7 @@
 package peer
 
-// Exported constants
-const (
-	DefaultProtocolPort = "3000"
-)
-
 // Unexported constants
 const (
-	nodeVersion   = 1
-	commandLength = 12
-	protocol      = "tcp"
+	nodeVersion = 1
+	protocol    = "tcp"
 )
@@ -2,122 +2,64 @@ package peer
 
 import (
 	"bytes"
-	"encoding/gob"
-	"encoding/hex"
-	"fmt"
-	"github.com/murlokito/gophercoin/blockchain"
-	"github.com/murlokito/gophercoin/transaction"
 	"io"
 	"io/ioutil"
 	"net"
-	"sync"
-)
-
-type addr struct {
-	AddrList []string
-}
-
-type block struct {
-	AddrFrom string
-	Block    []byte
-}
-
-type getblocks struct {
-	AddrFrom string
-}
-
-type getdata struct {
-	AddrFrom string
-	Type     string
-	ID       []byte
-}
-
-type inv struct {
-	AddrFrom string
-	Type     string
-	Items    [][]byte
-}
-
-type tx struct {
-	AddFrom     string
-	Transaction []byte
-}
-
-type version struct {
-	Version    int
-	BestHeight int
-	AddrFrom   string
-}
-
-func commandToBytes(command string) []byte {
-	var bytes [commandLength]byte
+	"time"
 
-	for i, c := range command {
-		bytes[i] = byte(c)
-	}
-
-	return bytes[:]
-}
+	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/transaction"
+	"github.com/murlokito/gophercoin/wire"
+)
 
-func bytesToCommand(bytes []byte) string {
-	var command []byte
+func (s PeerServer) handleConnection(conn net.Conn) {
+	defer s.wg.Done()
+	defer conn.Close()
 
-	for _, b := range bytes {
-		if b != 0x0 {
-			command = append(command, b)
-		}
+	request, err := ioutil.ReadAll(conn)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to read request")
+		return
 	}
 
-	return fmt.Sprintf("%s", command)
-}
-
-func (s PeerServer) handleConnection(conn net.Conn) {
-	request, err := ioutil.ReadAll(conn)
+	msg, err := wire.ReadMessage(bytes.NewReader(request), s.Config.Params.Net)
 	if err != nil {
-		s.logger.WithError(err)
+		s.logger.WithError(err).Error("Invalid message received, ignoring.")
 		return
 	}
-	command := bytesToCommand(request[:commandLength])
-	s.logger.Info("Received %s command\n", command)
-
-	switch command {
-	case "addr":
-		s.handleAddr(request)
-	case "block":
-		s.handleBlock(request)
-	case "inv":
-		s.handleInv(request)
-	case "getblocks":
-		s.handleGetBlocks(request)
-	case "getdata":
-		s.handleGetData(request)
-	case "tx":
-		s.handleTx(request)
-	case "version":
-		s.handleVersion(request)
+	s.logger.Info("Received %s command\n", msg.Command())
+
+	switch m := msg.(type) {
+	case *wire.MsgAddr:
+		s.handleAddr(m)
+	case *wire.MsgBlock:
+		s.handleBlock(m)
+	case *wire.MsgInv:
+		s.handleInv(m)
+	case *wire.MsgGetBlocks:
+		s.handleGetBlocks(m)
+	case *wire.MsgGetData:
+		s.handleGetData(m)
+	case *wire.MsgTx:
+		s.handleTx(m)
+	case *wire.MsgVersion:
+		s.handleVersion(m, conn.RemoteAddr())
 	default:
 		s.logger.Info("Unknown command received, ignoring.")
 	}
-
-	conn.Close()
-
-	s.wg.Done()
 }
 
-func gobEncode(data interface{}) ([]byte, error) {
+// sendMessage encodes the message and sends it to the peer
+func (s PeerServer) sendMessage(addr string, msg wire.Message) {
 	var buff bytes.Buffer
 
-	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(data)
+	err := wire.WriteMessage(&buff, msg, s.Config.Params.Net)
 	if err != nil {
-		return []byte{}, err
+		s.logger.WithError(err).Error("Failed to encode %s message", msg.Command())
+		return
 	}
 
-	return buff.Bytes(), nil
-}
-
-func extractCommand(request []byte) []byte {
-	return request[:commandLength]
+	s.sendData(addr, buff.Bytes())
 }
 
 func (s PeerServer) requestBlocks() {
@@ -127,36 +69,23 @@ func (s PeerServer) requestBlocks() {
 }
 
 func (s PeerServer) sendAddr(address string) {
-	nodes := addr{}
+	nodes := &wire.MsgAddr{}
 
 	for _, node := range s.KnownNodes {
 		nodes.AddrList = append(nodes.AddrList, node.Address)
 	}
 
-	payload, err := gobEncode(nodes)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-	request := append(commandToBytes("addr"), payload...)
-
-	s.sendData(address, request)
+	s.sendMessage(address, nodes)
 }
 
 func (s PeerServer) sendBlock(addr string, b *blockchain.Block) {
 	serBlock, err := b.SerializeBlock()
 	if err != nil {
-		s.logger.WithError(err)
-	}
-	data := block{s.NodeAddress, serBlock}
-	payload, err := gobEncode(data)
-	if err != nil {
-		s.logger.WithError(err)
+		s.logger.WithError(err).Error("Failed to serialize block %x", b.Hash)
 		return
 	}
-	request := append(commandToBytes("block"), payload...)
 
-	s.sendData(addr, request)
+	s.sendMessage(addr, &wire.MsgBlock{AddrFrom: s.NodeAddress, Block: serBlock})
 }
 
 func (s PeerServer) sendData(addr string, data []byte) {
@@ -184,50 +113,21 @@ func (s PeerServer) sendData(addr string, data []byte) {
 	}
 }
 
-func (s PeerServer) SendInv(address, kind string, items [][]byte) {
-	inventory := inv{s.NodeAddress, kind, items}
-	payload, err := gobEncode(inventory)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-	request := append(commandToBytes("inv"), payload...)
-
-	s.sendData(address, request)
+// SendInv announces the given blocks or transactions to the peer
+func (s PeerServer) SendInv(address string, kind wire.InvType, items [][]byte) {
+	s.sendMessage(address, &wire.MsgInv{AddrFrom: s.NodeAddress, Type: kind, Items: items})
 }
 
 func (s PeerServer) sendGetBlocks(address string) {
-	payload, err := gobEncode(getblocks{s.NodeAddress})
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-	request := append(commandToBytes("getblocks"), payload...)
-
-	s.sendData(address, request)
+	s.sendMessage(address, &wire.MsgGetBlocks{AddrFrom: s.NodeAddress})
 }
 
-func (s PeerServer) sendGetData(address, kind string, id []byte) {
-	payload, err := gobEncode(getdata{s.NodeAddress, kind, id})
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-	request := append(commandToBytes("getdata"), payload...)
-
-	s.sendData(address, request)
+func (s PeerServer) sendGetData(address string, kind wire.InvType, id []byte) {
+	s.sendMessage(address, &wire.MsgGetData{AddrFrom: s.NodeAddress, Type: kind, ID: id})
 }
 
 func (s PeerServer) sendTx(addr string, tnx *transaction.Transaction) {
-	data := tx{s.NodeAddress, tnx.Serialize()}
-	payload, err := gobEncode(data)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-	request := append(commandToBytes("tx"), payload...)
-
-	s.sendData(addr, request)
+	s.sendMessage(addr, &wire.MsgTx{AddrFrom: s.NodeAddress, Transaction: tnx.Serialize()})
 }
 
 func (s PeerServer) SendVersion(addr string) {
@@ -238,30 +138,18 @@ func (s PeerServer) SendVersion(addr string) {
 		bestHeight = -1
 	}
 	s.logger.Info("Best height: %d \n", bestHeight)
-	version := version{nodeVersion, bestHeight, s.NodeAddress}
-	payload, err := gobEncode(version)
-	if err != nil {
-		s.logger.WithError(err)
-		return
+	version := &wire.MsgVersion{
+		Version:    nodeVersion,
+		BestHeight: int32(bestHeight),
+		Timestamp:  time.Now().Unix(),
+		AddrFrom:   s.NodeAddress,
 	}
-	s.logger.Info("Sending payload:\n%+v\n-------------\n",
-		bytesToCommand(payload))
-	request := append(commandToBytes("version"), payload...)
+	s.logger.Info("Sending version:\n%+v\n-------------\n", version)
 
-	s.sendData(addr, request)
+	s.sendMessage(addr, version)
 }
 
-func (s PeerServer) handleAddr(request []byte) {
-	var buff bytes.Buffer
-	var payload addr
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
+func (s PeerServer) handleAddr(payload *wire.MsgAddr) {
 	var updatedNodes []Peer
 	updatedNodes = s.KnownNodes
 	for _, node := range s.KnownNodes {
@@ -281,19 +169,7 @@ func (s PeerServer) handleAddr(request []byte) {
 	s.requestBlocks()
 }
 
-func (s PeerServer) handleBlock(request []byte) {
-
-	var buff bytes.Buffer
-	var payload block
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-
+func (s PeerServer) handleBlock(payload *wire.MsgBlock) {
 	blockData := payload.Block
 	block, err := blockchain.DeserializeBlock(blockData)
 	if err != nil {
@@ -303,49 +179,66 @@ func (s PeerServer) handleBlock(request []byte) {
 	s.logger.Info("Received a new block!\n%+v\v", block)
 
 	if s.chainMgr.Chain != nil {
-		s.chainMgr.Chain.AddBlock(block)
+		isOrphan, err := s.chainMgr.Chain.ProcessBlock(block)
+		if err != nil {
+			s.logger.WithError(err).Error("Rejected block %x", block.Hash)
+			return
+		}
+
+		// Ask the peer for the missing ancestors, the orphan
+		// is connected once they arrive
+		if isOrphan {
+			missing := s.chainMgr.Chain.MissingAncestor(block.Hash)
+			s.logger.Info("Block %x is an orphan, requesting %x\n", block.Hash, missing)
+			s.sendGetData(payload.AddrFrom, wire.InvTypeBlock, missing)
+			return
+		}
 	} else {
-		db, err := blockchain.CreateBlockchain("")
+		if len(block.PrevBlockHash) != 0 {
+			s.logger.Info("Ignoring block %x, no chain to connect it to\n", block.Hash)
+			return
+		}
+
+		if !bytes.Equal(block.Hash, s.Config.Params.GenesisHash) {
+			s.logger.Info("Ignoring block %x, not the genesis block of %s\n", block.Hash, s.Config.Params.Name)
+			return
+		}
+
+		db, err := blockchain.CreateBlockchain(s.Config.DBPath, s.Config.Params)
 		if err != nil {
 			s.logger.Info("Failed to create db: %v", err)
 			return
 		}
-		s.chainMgr.Chain = db
-		s.chainMgr.Chain.AddGenesis(block)
+		s.chainMgr.SetChain(db)
 	}
 
 	s.logger.Info("Added block %x\n", block.Hash)
 
 	if len(s.blocksInTransit) > 0 {
 		blockHash := s.blocksInTransit[0]
-		s.sendGetData(payload.AddrFrom, "block", blockHash)
+		s.sendGetData(payload.AddrFrom, wire.InvTypeBlock, blockHash)
 
 		s.blocksInTransit = s.blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{s.chainMgr.Chain, &sync.RWMutex{}}
-		UTXOSet.Reindex()
 	}
 }
 
-func (s PeerServer) handleInv(request []byte) {
-	var buff bytes.Buffer
-	var payload inv
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-
+func (s PeerServer) handleInv(payload *wire.MsgInv) {
 	s.logger.Info("Received inventory with %d %s\n", len(payload.Items), payload.Type)
 
-	if payload.Type == "block" {
-		blocksInTransit := payload.Items
+	if payload.Type == wire.InvTypeBlock {
+		var blocksInTransit [][]byte
+		for _, b := range payload.Items {
+			if s.chainMgr.Chain == nil ||
+				(!s.chainMgr.Chain.HaveBlock(b) && !s.chainMgr.Chain.IsKnownOrphan(b)) {
+				blocksInTransit = append(blocksInTransit, b)
+			}
+		}
+		if len(blocksInTransit) == 0 {
+			return
+		}
 
-		blockHash := payload.Items[0]
-		s.sendGetData(payload.AddrFrom, "block", blockHash)
+		blockHash := blocksInTransit[0]
+		s.sendGetData(payload.AddrFrom, wire.InvTypeBlock, blockHash)
 
 		newInTransit := [][]byte{}
 		for _, b := range blocksInTransit {
@@ -356,46 +249,22 @@ func (s PeerServer) handleInv(request []byte) {
 		s.blocksInTransit = newInTransit
 	}
 
-	if payload.Type == "tx" {
+	if payload.Type == wire.InvTypeTx {
 		txID := payload.Items[0]
 
-		if s.chainMgr.MemPool[hex.EncodeToString(txID)].ID == nil {
-			s.sendGetData(payload.AddrFrom, "tx", txID)
+		if !s.txPool.HaveTransaction(txID) {
+			s.sendGetData(payload.AddrFrom, wire.InvTypeTx, txID)
 		}
 	}
 }
 
-func (s PeerServer) handleGetBlocks(request []byte) {
-
-	var buff bytes.Buffer
-	var payload getblocks
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-
+func (s PeerServer) handleGetBlocks(payload *wire.MsgGetBlocks) {
 	blocks := s.chainMgr.Chain.GetBlockHashes()
-	s.SendInv(payload.AddrFrom, "block", blocks)
+	s.SendInv(payload.AddrFrom, wire.InvTypeBlock, blocks)
 }
 
-func (s PeerServer) handleGetData(request []byte) {
-
-	var buff bytes.Buffer
-	var payload getdata
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		s.logger.WithError(err)
-		return
-	}
-
-	if payload.Type == "block" {
+func (s PeerServer) handleGetData(payload *wire.MsgGetData) {
+	if payload.Type == wire.InvTypeBlock {
 		block, err := s.chainMgr.Chain.GetBlock([]byte(payload.ID))
 		if err != nil {
 			return
@@ -404,62 +273,64 @@ func (s PeerServer) handleGetData(request []byte) {
 		s.sendBlock(payload.AddrFrom, &block)
 	}
 
-	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.ID)
-		tx := s.chainMgr.MemPool[txID]
+	if payload.Type == wire.InvTypeTx {
+		tx, err := s.txPool.FetchTransaction(payload.ID)
+		if err != nil {
+			return
+		}
 
-		s.sendTx(payload.AddrFrom, &tx)
-		// delete(memPool, txID)
+		s.sendTx(payload.AddrFrom, tx)
 	}
 }
 
-func (s PeerServer) handleTx(request []byte) {
-
-	var buff bytes.Buffer
-	var payload tx
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
+func (s PeerServer) handleTx(payload *wire.MsgTx) {
+	txData := payload.Transaction
+	tx, err := transaction.DeserializeTransaction(txData)
 	if err != nil {
-		s.logger.WithError(err)
+		s.logger.WithError(err).Error("Failed to deserialize transaction")
 		return
 	}
 
-	txData := payload.Transaction
-	tx := transaction.DeserializeTransaction(txData)
-	s.chainMgr.MemPool[hex.EncodeToString(tx.ID)] = tx
+	err = s.txPool.ProcessTransaction(&tx)
+	if err != nil {
+		s.logger.WithError(err).Error("Rejected transaction %x", tx.ID)
+		return
+	}
 
 	if s.MinerChan != nil {
-		s.MinerChan <- txData
+		select {
+		case s.MinerChan <- txData:
+		default:
+		}
 	}
 
 	if len(s.KnownNodes) > 0 {
 		for _, node := range s.KnownNodes {
-			if node.Address != s.NodeAddress && node.Address != payload.AddFrom {
-				s.SendInv(node.Address, "tx", [][]byte{tx.ID})
+			if node.Address != s.NodeAddress && node.Address != payload.AddrFrom {
+				s.SendInv(node.Address, wire.InvTypeTx, [][]byte{tx.ID})
 			}
 		}
 	}
 
 }
 
-func (s PeerServer) handleVersion(request []byte) {
-	var buff bytes.Buffer
-	var payload version
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
+func (s PeerServer) handleVersion(payload *wire.MsgVersion, remoteAddr net.Addr) {
+	// Every host reports its time once, the chain checks the timestamps
+	// of new blocks against the adjusted time. The sample is keyed by the
+	// host the connection comes from rather than by the address the peer
+	// claims, so a single peer can not skew the adjusted time.
+	host, _, err := net.SplitHostPort(remoteAddr.String())
 	if err != nil {
-		s.logger.WithError(err)
-		return
+		host = remoteAddr.String()
 	}
+	s.chainMgr.TimeSource.AddTimeSample(host, time.Unix(payload.Timestamp, 0))
+	s.logger.Info("Peer %s time offset sample added, adjusted time offset is %v\n", host, s.chainMgr.TimeSource.Offset())
 
 	// sendAddr(payload.AddrFrom)
 	if !s.nodeIsKnown(payload.AddrFrom) {
 		s.logger.Info("Node %s is unknown, adding to peer list\n", payload.AddrFrom)
 		s.KnownNodes = append(s.KnownNodes, Peer{Address: payload.AddrFrom})
+		s.SavePeers()
 	}
 
 	if s.chainMgr.Chain == nil && payload.BestHeight != 0 {
@@ -475,7 +346,7 @@ func (s PeerServer) handleVersion(request []byte) {
 		s.logger.Info("Database not found, best height is 0.")
 		myBestHeight = -1
 	}
-	foreignerBestHeight := payload.BestHeight
+	foreignerBestHeight := int(payload.BestHeight)
 
 	s.logger.Info("My best height: %d \tPeer %s best height: %d\n", myBestHeight, payload.AddrFrom, foreignerBestHeight)
 
@@ -1,15 +1,16 @@
 package peer
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net"
 	"os"
-	"os/signal"
 	"sync"
-	"syscall"
 
 	"github.com/murlokito/gophercoin/log"
 
 	"github.com/murlokito/gophercoin/blockchain"
+	"github.com/murlokito/gophercoin/mempool"
 )
 
 // Peer is the structure that defines a peer
@@ -30,68 +31,124 @@ type PeerServer struct {
 	MinerChan   chan []byte
 
 	listener        net.Listener
+	quit            chan struct{}
 	chainMgr        *blockchain.ChainManager
+	txPool          *mempool.TxPool
 	blocksInTransit [][]byte
 	wg              *sync.WaitGroup
 	logger          log.Logger
 }
 
 // Start is the function used to start the PeerServer
-func (s PeerServer) Start() {
-	defer s.wg.Done()
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		s.logger.Info("Catching signal, terminating gracefully.")
-
-		os.Exit(1)
-	}()
-
+func (s *PeerServer) Start() {
 	if s.Config.Port != "" {
 		s.NodeAddress = ":" + s.Config.Port
 	} else {
-		s.NodeAddress = ":" + DefaultProtocolPort
+		s.NodeAddress = ":" + s.Config.Params.DefaultPort
 	}
 
 	lis, err := net.Listen(protocol, s.NodeAddress)
 	if err != nil {
-		s.logger.WithError(err)
+		s.logger.WithError(err).Error("Failed to listen for peer connections")
 		return
 	}
 	s.listener = lis
 	s.logger.Info("PeerServer listening on port %s", s.NodeAddress)
 
-	go s.Listen()
 	s.wg.Add(1)
+	go s.Listen()
 }
 
-// Listen to peer connections
-func (s PeerServer) Listen() {
+// Listen to peer connections until the server is stopped
+func (s *PeerServer) Listen() {
+	defer s.wg.Done()
+
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
-			s.logger.WithError(err)
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
+			s.logger.WithError(err).Error("Failed to accept peer connection")
+			continue
 		}
-		go s.handleConnection(conn)
+
 		s.wg.Add(1)
+		go s.handleConnection(conn)
+	}
+}
+
+// Stop closes the listener of the server, the connections
+// being handled are left to finish
+func (s *PeerServer) Stop() {
+	if s.listener == nil {
+		return
 	}
+
+	close(s.quit)
+	err := s.listener.Close()
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to close the peer listener")
+	}
+	s.listener = nil
 }
 
-// NewPeerServer creates a new peer server with the passed config
-func NewPeerServer(config Config, wg *sync.WaitGroup, chainMgr *blockchain.ChainManager) *PeerServer {
+// loadPeers reads the known nodes from the peers file
+func (s *PeerServer) loadPeers() error {
+	if s.Config.PeersFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(s.Config.PeersFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &s.KnownNodes)
+}
+
+// SavePeers writes the known nodes to the peers file
+func (s PeerServer) SavePeers() {
+	if s.Config.PeersFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(s.KnownNodes)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to encode known nodes")
+		return
+	}
+
+	err = ioutil.WriteFile(s.Config.PeersFile, data, 0644)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to save known nodes")
+	}
+}
+
+// NewPeerServer creates a new peer server with the passed config,
+// which listens for peer connections once started
+func NewPeerServer(config Config, wg *sync.WaitGroup, chainMgr *blockchain.ChainManager, txPool *mempool.TxPool) *PeerServer {
 	server := &PeerServer{
+		Config:          config,
 		KnownNodes:      make([]Peer, 0),
 		MinerChan:       nil,
 		chainMgr:        chainMgr,
+		txPool:          txPool,
 		blocksInTransit: make([][]byte, 0),
+		quit:            make(chan struct{}),
 		wg:              wg,
 		logger:          log.NewLogger(config.LogLevel),
 	}
 
-	go server.Start()
-	wg.Add(1)
+	err := server.loadPeers()
+	if err != nil {
+		server.logger.WithError(err).Error("Failed to load known nodes")
+	}
 
 	return server
 }
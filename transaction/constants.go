@@ -1,6 +1,12 @@
 package transaction
 
-// Exported constants
+// Unexported constants
 const (
-	Subsidy = 10
+	// maxScriptLen is the maximum length of a signature,
+	// public key or public key hash
+	maxScriptLen = 10000
+	// maxTxInputs is the maximum number of inputs of a transaction
+	maxTxInputs = 100000
+	// maxTxOutputs is the maximum number of outputs of a transaction
+	maxTxOutputs = 100000
 )
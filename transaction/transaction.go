@@ -6,13 +6,16 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
 	"strings"
+
+	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/wire"
 )
 
 // Transaction represents a Bitcoin-like transaction
@@ -23,16 +26,15 @@ type Transaction struct {
 }
 
 // DeserializeTransaction deserializes a transaction
-func DeserializeTransaction(data []byte) Transaction {
+func DeserializeTransaction(data []byte) (Transaction, error) {
 	var transaction Transaction
 
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
+	err := transaction.Decode(bytes.NewReader(data))
 	if err != nil {
-		log.Panic(err)
+		return Transaction{}, err
 	}
 
-	return transaction
+	return transaction, nil
 }
 
 // IsCoinbase checks whether the transaction is coinbase
@@ -40,12 +42,92 @@ func (tx Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
 }
 
-// Serialize sets ID of a transaction
+// Encode writes the transaction to w: its ID followed
+// by the inputs and the outputs, each prefixed by their count
+func (tx *Transaction) Encode(w io.Writer) error {
+	err := wire.WriteVarBytes(w, tx.ID)
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteVarInt(w, uint64(len(tx.Vin)))
+	if err != nil {
+		return err
+	}
+
+	for i := range tx.Vin {
+		err = tx.Vin[i].Encode(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = wire.WriteVarInt(w, uint64(len(tx.Vout)))
+	if err != nil {
+		return err
+	}
+
+	for i := range tx.Vout {
+		err = tx.Vout[i].Encode(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads a transaction written by Encode from r
+func (tx *Transaction) Decode(r io.Reader) error {
+	var err error
+
+	tx.ID, err = wire.ReadVarBytes(r, wire.HashSize, "transaction id")
+	if err != nil {
+		return err
+	}
+
+	count, err := wire.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count > maxTxInputs {
+		return fmt.Errorf("too many inputs [count %d, max %d]", count, maxTxInputs)
+	}
+
+	tx.Vin = make([]TXInput, count)
+	for i := range tx.Vin {
+		err = tx.Vin[i].Decode(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	count, err = wire.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count > maxTxOutputs {
+		return fmt.Errorf("too many outputs [count %d, max %d]", count, maxTxOutputs)
+	}
+
+	tx.Vout = make([]TXOutput, count)
+	for i := range tx.Vout {
+		err = tx.Vout[i].Decode(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Serialize returns the encoding of the transaction
 func (tx *Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
+	err := tx.Encode(&encoded)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -54,7 +136,8 @@ func (tx *Transaction) Serialize() []byte {
 }
 
 // NewCoinbaseTX creates a new coinbase transaction
-func NewCoinbaseTX(to, data string) *Transaction {
+// paying the given value to the given address
+func NewCoinbaseTX(to, data string, value int) *Transaction {
 	if data == "" {
 
 		data = fmt.Sprintf("Reward to '%s'", to)
@@ -68,7 +151,7 @@ func NewCoinbaseTX(to, data string) *Transaction {
 	}
 
 	txIn := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txOut := NewTXOutput(Subsidy, to)
+	txOut := NewTXOutput(value, to)
 	tx := Transaction{nil, []TXInput{txIn}, []TXOutput{*txOut}}
 	tx.ID = tx.Hash()
 	log.Printf("New coinbase TX: %v", tx.ID)
@@ -76,13 +159,15 @@ func NewCoinbaseTX(to, data string) *Transaction {
 	return &tx
 }
 
-// NewUTXOTransaction creates a new transaction from the passed transaction inputs
-func NewUTXOTransaction(acc int, validOutputs map[string][]int, to string, amount int, addrFrom []byte) (*Transaction, error) {
+// NewUTXOTransaction creates a new transaction from the passed transaction inputs,
+// which are owned by the given public key, paying the given fee. The change is
+// sent back to its address.
+func NewUTXOTransaction(acc int, validOutputs map[string][]int, to string, amount, fee int, pubKey []byte) (*Transaction, error) {
 	var inputs []TXInput
 	var outputs []TXOutput
 
 	log.Printf("newutxotransaction: acc:%+v validOutputs:%+v\n", acc, validOutputs)
-	if acc < amount {
+	if acc < amount+fee {
 		return nil, errors.New("insufficient balance")
 	}
 
@@ -94,16 +179,15 @@ func NewUTXOTransaction(acc int, validOutputs map[string][]int, to string, amoun
 		}
 
 		for _, out := range outs {
-			input := TXInput{txID, out, nil, addrFrom}
+			input := TXInput{txID, out, nil, pubKey}
 			inputs = append(inputs, input)
 		}
 	}
 
 	// Build a list of outputs
-	from := fmt.Sprintf("%s", addrFrom)
 	outputs = append(outputs, *NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *NewTXOutput(acc-amount, from)) // a change
+	if acc > amount+fee {
+		outputs = append(outputs, TXOutput{acc - amount - fee, address.HashPubKey(pubKey)}) // a change
 	}
 
 	tx := Transaction{nil, inputs, outputs}
@@ -151,11 +235,19 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		if err != nil {
 			return err
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
+		// Both halves are padded to the curve size so the
+		// signature can be split in the middle when verifying
+		signature := make([]byte, 64)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rBytes):32], rBytes)
+		copy(signature[64-len(sBytes):], sBytes)
 
 		tx.Vin[inID].Signature = signature
 	}
 
+	// The ID commits to the signatures, so it changes once they are set
+	tx.ID = tx.Hash()
+
 	return nil
 }
 
@@ -206,19 +298,43 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		return true
 	}
 
+	var prevOuts []TXOutput
 	for _, vin := range tx.Vin {
-		if prevTXs[hex.EncodeToString(vin.Txid)].ID == nil {
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		if prevTx.ID == nil {
 			log.Panic("ERROR: Previous transaction is not correct")
 		}
+		if vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return false
+		}
+		prevOuts = append(prevOuts, prevTx.Vout[vin.Vout])
+	}
+
+	return tx.VerifySignatures(prevOuts)
+}
+
+// VerifySignatures verifies signatures of Transaction inputs against
+// the outputs they spend, passed in the same order as the inputs.
+// Each input must also carry the public key the output is locked to.
+func (tx *Transaction) VerifySignatures(prevOuts []TXOutput) bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+
+	if len(prevOuts) != len(tx.Vin) {
+		return false
 	}
 
 	txCopy := tx.TrimmedCopy()
 	curve := elliptic.P256()
 
 	for inID, vin := range tx.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		if !vin.UsesKey(prevOuts[inID].PubKeyHash) {
+			return false
+		}
+
 		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PubKey = prevTx.Vout[vin.Vout].PubKeyHash
+		txCopy.Vin[inID].PubKey = prevOuts[inID].PubKeyHash
 		txCopy.ID = txCopy.Hash()
 		txCopy.Vin[inID].PubKey = nil
 
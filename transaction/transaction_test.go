@@ -0,0 +1,47 @@
+package transaction
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTransactionEncoding checks a transaction against its known
+// encoding and ID, which any implementation must reproduce
+func TestTransactionEncoding(t *testing.T) {
+	tx := Transaction{
+		Vin:  []TXInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("gophercoin")}},
+		Vout: []TXOutput{{Value: 10, PubKeyHash: []byte{0x01, 0x02, 0x03, 0x04}}},
+	}
+	tx.ID = tx.Hash()
+
+	assert.Equal(t, "703fe3cc08f9edc39f765ae86371b22485cdfddb5bcdfd71479bb7477d6358e5", hex.EncodeToString(tx.ID))
+
+	encoded := "20703fe3cc08f9edc39f765ae86371b22485cdfddb5bcdfd71479bb7477d6358e5" +
+		"01" + "00" + "ffffffff" + "00" + "0a676f70686572636f696e" +
+		"01" + "0a00000000000000" + "0401020304"
+	assert.Equal(t, encoded, hex.EncodeToString(tx.Serialize()))
+
+	decoded, err := DeserializeTransaction(tx.Serialize())
+	assert.NoError(t, err)
+	assert.True(t, decoded.IsCoinbase())
+	assert.Equal(t, tx.ID, decoded.Hash())
+	assert.Equal(t, tx.Serialize(), decoded.Serialize())
+}
+
+// TestTXOutputsEncoding checks outputs are encoded
+// ordered by index whatever the map order is
+func TestTXOutputsEncoding(t *testing.T) {
+	outs := NewTXOutputs()
+	outs.Height = 5
+	outs.Coinbase = true
+	outs.Outputs[3] = TXOutput{Value: 5, PubKeyHash: []byte{0xaa}}
+	outs.Outputs[0] = TXOutput{Value: 7, PubKeyHash: []byte{0xbb}}
+
+	encoded := "0b" + "02" +
+		"00" + "0700000000000000" + "01bb" +
+		"03" + "0500000000000000" + "01aa"
+	assert.Equal(t, encoded, hex.EncodeToString(outs.Serialize()))
+	assert.Equal(t, outs, DeserializeOutputs(outs.Serialize()))
+}
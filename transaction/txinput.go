@@ -2,7 +2,10 @@ package transaction
 
 import (
 	"bytes"
+	"io"
+
 	"github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/wire"
 )
 
 // TXInput represents a transaction input
@@ -19,3 +22,49 @@ func (in *TXInput) UsesKey(pubKeyHash []byte) bool {
 
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
+
+// Encode writes the input to w: the spent transaction ID, the
+// index of the spent output, the signature and the public key
+func (in *TXInput) Encode(w io.Writer) error {
+	err := wire.WriteVarBytes(w, in.Txid)
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteUint32(w, uint32(in.Vout))
+	if err != nil {
+		return err
+	}
+
+	err = wire.WriteVarBytes(w, in.Signature)
+	if err != nil {
+		return err
+	}
+
+	return wire.WriteVarBytes(w, in.PubKey)
+}
+
+// Decode reads an input written by Encode from r
+func (in *TXInput) Decode(r io.Reader) error {
+	var err error
+
+	in.Txid, err = wire.ReadVarBytes(r, wire.HashSize, "input txid")
+	if err != nil {
+		return err
+	}
+
+	vout, err := wire.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	// The coinbase's -1 is encoded as 0xffffffff
+	in.Vout = int(int32(vout))
+
+	in.Signature, err = wire.ReadVarBytes(r, maxScriptLen, "input signature")
+	if err != nil {
+		return err
+	}
+
+	in.PubKey, err = wire.ReadVarBytes(r, maxScriptLen, "input pubkey")
+	return err
+}
@@ -2,9 +2,14 @@ package transaction
 
 import (
 	"bytes"
-	"encoding/gob"
-	address2 "github.com/murlokito/gophercoin/address"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"sort"
+
+	address2 "github.com/murlokito/gophercoin/address"
+	"github.com/murlokito/gophercoin/wire"
 )
 
 // TXOutput represents a transaction output
@@ -33,12 +38,34 @@ func NewTXOutput(value int, address string) *TXOutput {
 	return txo
 }
 
+// Encode writes the output to w: its value and the
+// hash of the public key it is locked to
+func (out *TXOutput) Encode(w io.Writer) error {
+	err := wire.WriteUint64(w, uint64(out.Value))
+	if err != nil {
+		return err
+	}
+
+	return wire.WriteVarBytes(w, out.PubKeyHash)
+}
+
+// Decode reads an output written by Encode from r
+func (out *TXOutput) Decode(r io.Reader) error {
+	value, err := wire.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	out.Value = int(int64(value))
+
+	out.PubKeyHash, err = wire.ReadVarBytes(r, maxScriptLen, "output pubkey hash")
+	return err
+}
+
 // Serialize serializes TXOutputs
 func (out *TXOutput) Serialize() []byte {
 	var buff bytes.Buffer
 
-	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(out)
+	err := out.Encode(&buff)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -46,17 +73,119 @@ func (out *TXOutput) Serialize() []byte {
 	return buff.Bytes()
 }
 
-// TXOutputs collects TXOutput
+// TXOutputs collects TXOutput, keyed by their index
+// in the transaction which created them so the index
+// survives when some of the outputs are spent, along with
+// the height of the block which created them and whether
+// they were created by a coinbase
 type TXOutputs struct {
-	Outputs []TXOutput
+	Outputs  map[int]TXOutput
+	Height   int
+	Coinbase bool
+}
+
+// NewTXOutputs creates an empty TXOutputs
+func NewTXOutputs() TXOutputs {
+	return TXOutputs{Outputs: make(map[int]TXOutput)}
+}
+
+// IsMature returns whether the outputs can be spent in the block at the
+// given height. Coinbase outputs can only be spent once maturity blocks
+// have been built on top of the block which created them.
+func (outs TXOutputs) IsMature(spendHeight, maturity int) bool {
+	return !outs.Coinbase || spendHeight-outs.Height >= maturity
+}
+
+// Encode writes the outputs to w as a varint holding the height shifted
+// left by one with the lowest bit set for a coinbase, then ordered by
+// their index, as a varint count followed by the index as a varint and
+// the output for each one
+func (outs TXOutputs) Encode(w io.Writer) error {
+	code := uint64(outs.Height) << 1
+	if outs.Coinbase {
+		code |= 1
+	}
+
+	err := wire.WriteVarInt(w, code)
+	if err != nil {
+		return err
+	}
+
+	indexes := make([]int, 0, len(outs.Outputs))
+	for index := range outs.Outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	err = wire.WriteVarInt(w, uint64(len(indexes)))
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		err = wire.WriteVarInt(w, uint64(index))
+		if err != nil {
+			return err
+		}
+
+		out := outs.Outputs[index]
+		err = out.Encode(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads outputs written by Encode from r
+func (outs *TXOutputs) Decode(r io.Reader) error {
+	code, err := wire.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+	if code>>1 > math.MaxInt32 {
+		return fmt.Errorf("height %d out of range", code>>1)
+	}
+	outs.Height = int(code >> 1)
+	outs.Coinbase = code&1 == 1
+
+	count, err := wire.ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count > maxTxOutputs {
+		return fmt.Errorf("too many outputs [count %d, max %d]", count, maxTxOutputs)
+	}
+
+	outs.Outputs = make(map[int]TXOutput, count)
+	for i := uint64(0); i < count; i++ {
+		index, err := wire.ReadVarInt(r)
+		if err != nil {
+			return err
+		}
+
+		if index > maxTxOutputs {
+			return fmt.Errorf("output index %d out of range", index)
+		}
+
+		var out TXOutput
+		err = out.Decode(r)
+		if err != nil {
+			return err
+		}
+		outs.Outputs[int(index)] = out
+	}
+
+	return nil
 }
 
 // Serialize serializes TXOutputs
 func (outs TXOutputs) Serialize() []byte {
 	var buff bytes.Buffer
 
-	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(outs)
+	err := outs.Encode(&buff)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -68,8 +197,7 @@ func (outs TXOutputs) Serialize() []byte {
 func DeserializeOutputs(data []byte) TXOutputs {
 	var outputs TXOutputs
 
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&outputs)
+	err := outputs.Decode(bytes.NewReader(data))
 	if err != nil {
 		log.Panic(err)
 	}
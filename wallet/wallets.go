@@ -14,17 +14,23 @@ import (
 // Wallet stores a collection of Wallet
 type Wallet struct {
 	Wallet map[string]*address.Address
+
+	// version is the version byte of the addresses of the
+	// network the wallet is used on
+	version byte
 }
 
-// NewWallet creates Wallet and fills it from a file if it exists
-func NewWallet(fileName string) (*Wallet, error) {
-	Wallet := Wallet{}
+// NewWallet creates Wallet and fills it from the file at the given
+// path if it exists, else creates the file. Its addresses are
+// encoded with the given version byte.
+func NewWallet(fileName string, version byte) (*Wallet, error) {
+	Wallet := Wallet{version: version}
 	Wallet.Wallet = make(map[string]*address.Address)
 
 	err := Wallet.LoadFromFile(fileName)
 	if os.IsNotExist(err) {
 		log.Printf("[gcw] Wallet did not exist, creating.")
-		Wallet.SaveToFile("")
+		Wallet.SaveToFile(fileName)
 	}
 
 	return &Wallet, nil
@@ -33,7 +39,7 @@ func NewWallet(fileName string) (*Wallet, error) {
 // CreateAddress adds an Address to Wallet
 func (ws *Wallet) CreateAddress() string {
 	wallet := address.NewAddress()
-	address := fmt.Sprintf("%s", wallet.GetAddress())
+	address := fmt.Sprintf("%s", wallet.GetAddress(ws.version))
 	log.Printf("New address created: %s", address)
 	ws.Wallet[address] = wallet
 
@@ -68,19 +74,18 @@ func (ws Wallet) GetAddress(address string) address.Address {
 	return *ws.Wallet[address]
 }
 
-// LoadFromFile loads Wallet from a file
+// LoadFromFile loads Wallet from the file at the given path
 func (ws *Wallet) LoadFromFile(fileName string) error {
 	var (
 		walletFile string
 	)
 
 	// In case no wallet file name is passed we'll use the default file name
-	if fileName == "" {
-		fileName = Bucket
+	walletFile = fileName
+	if walletFile == "" {
+		walletFile = Bucket + Extension
 	}
 
-	walletFile = fmt.Sprintf("%s%s", fileName, Extension)
-
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err
 	}
@@ -103,7 +108,7 @@ func (ws *Wallet) LoadFromFile(fileName string) error {
 	return nil
 }
 
-// SaveToFile saves Wallet to a file
+// SaveToFile saves Wallet to the file at the given path
 func (ws Wallet) SaveToFile(fileName string) {
 	var (
 		content    bytes.Buffer
@@ -111,10 +116,10 @@ func (ws Wallet) SaveToFile(fileName string) {
 	)
 
 	// In case no wallet file name is passed we'll use the default file name
-	if fileName == "" {
-		fileName = Bucket
+	walletFile = fileName
+	if walletFile == "" {
+		walletFile = Bucket + Extension
 	}
-	walletFile = fmt.Sprintf("%s%s", fileName, Extension)
 
 	gob.Register(elliptic.P256())
 
@@ -0,0 +1,224 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HashSize is the size of the hashes used for blocks and transactions
+const HashSize = 32
+
+// MaxVarBytesLen is the maximum length of a var bytes field, large
+// enough to hold a serialized block sent inside a message
+const MaxVarBytesLen = 32 * 1024 * 1024
+
+// MessageError describes an issue with a message or a value
+// being decoded, such as a non canonical varint
+type MessageError struct {
+	Func        string
+	Description string
+}
+
+// Error satisfies the error interface and prints human-readable errors
+func (e *MessageError) Error() string {
+	if e.Func != "" {
+		return fmt.Sprintf("%s: %s", e.Func, e.Description)
+	}
+	return e.Description
+}
+
+// messageError creates a MessageError given a set of arguments
+func messageError(f string, desc string) *MessageError {
+	return &MessageError{Func: f, Description: desc}
+}
+
+// ReadUint32 reads a little endian uint32 from r
+func ReadUint32(r io.Reader) (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+// WriteUint32 writes v to w as a little endian uint32
+func WriteUint32(w io.Writer, v uint32) error {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// ReadUint64 reads a little endian uint64 from r
+func ReadUint64(r io.Reader) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+// WriteUint64 writes v to w as a little endian uint64
+func WriteUint64(w io.Writer, v uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// ReadHash reads a 32 byte hash from r. A hash of all zeroes
+// is returned as an empty slice, the way it was before encoding.
+func ReadHash(r io.Reader) ([]byte, error) {
+	var hash [HashSize]byte
+	if _, err := io.ReadFull(r, hash[:]); err != nil {
+		return nil, err
+	}
+
+	if hash == [HashSize]byte{} {
+		return []byte{}, nil
+	}
+	return hash[:], nil
+}
+
+// WriteHash writes hash to w as 32 bytes, zero padded at the end
+// when shorter. Hashes longer than 32 bytes are rejected.
+func WriteHash(w io.Writer, hash []byte) error {
+	if len(hash) > HashSize {
+		return messageError("WriteHash", fmt.Sprintf("hash is %d bytes, more than %d", len(hash), HashSize))
+	}
+
+	var buf [HashSize]byte
+	copy(buf[:], hash)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// ReadVarInt reads a variable length integer from r, rejecting
+// values which are not encoded in their shortest form
+func ReadVarInt(r io.Reader) (uint64, error) {
+	var discriminant [1]byte
+	if _, err := io.ReadFull(r, discriminant[:]); err != nil {
+		return 0, err
+	}
+
+	var v, min uint64
+	switch discriminant[0] {
+	case 0xff:
+		n, err := ReadUint64(r)
+		if err != nil {
+			return 0, err
+		}
+		v, min = n, 0x100000000
+
+	case 0xfe:
+		n, err := ReadUint32(r)
+		if err != nil {
+			return 0, err
+		}
+		v, min = uint64(n), 0x10000
+
+	case 0xfd:
+		var buf [2]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		v, min = uint64(binary.LittleEndian.Uint16(buf[:])), 0xfd
+
+	default:
+		return uint64(discriminant[0]), nil
+	}
+
+	if v < min {
+		return 0, messageError("ReadVarInt", fmt.Sprintf("non canonical varint %x - discriminant %x must encode a value greater than %x",
+			v, discriminant[0], min))
+	}
+
+	return v, nil
+}
+
+// WriteVarInt writes v to w using the shortest varint encoding
+func WriteVarInt(w io.Writer, v uint64) error {
+	var buf []byte
+
+	switch {
+	case v < 0xfd:
+		buf = []byte{byte(v)}
+	case v <= 0xffff:
+		buf = make([]byte, 3)
+		buf[0] = 0xfd
+		binary.LittleEndian.PutUint16(buf[1:], uint16(v))
+	case v <= 0xffffffff:
+		buf = make([]byte, 5)
+		buf[0] = 0xfe
+		binary.LittleEndian.PutUint32(buf[1:], uint32(v))
+	default:
+		buf = make([]byte, 9)
+		buf[0] = 0xff
+		binary.LittleEndian.PutUint64(buf[1:], v)
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// VarIntSerializeSize returns the number of bytes it takes
+// to encode v as a varint
+func VarIntSerializeSize(v uint64) int {
+	switch {
+	case v < 0xfd:
+		return 1
+	case v <= 0xffff:
+		return 3
+	case v <= 0xffffffff:
+		return 5
+	}
+	return 9
+}
+
+// ReadVarBytes reads a varint length followed by that many bytes from r.
+// Lengths above maxAllowed are rejected before allocating, fieldName is
+// only used in the error message.
+func ReadVarBytes(r io.Reader, maxAllowed uint64, fieldName string) ([]byte, error) {
+	count, err := ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > maxAllowed {
+		return nil, messageError("ReadVarBytes", fmt.Sprintf("%s is larger than the max allowed size [count %d, max %d]",
+			fieldName, count, maxAllowed))
+	}
+
+	b := make([]byte, count)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// WriteVarBytes writes b to w prefixed by its length as a varint
+func WriteVarBytes(w io.Writer, b []byte) error {
+	err := WriteVarInt(w, uint64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// ReadVarString reads a varint length followed by that many bytes
+// from r and returns them as a string
+func ReadVarString(r io.Reader, maxAllowed uint64) (string, error) {
+	b, err := ReadVarBytes(r, maxAllowed, "string")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// WriteVarString writes s to w prefixed by its length as a varint
+func WriteVarString(w io.Writer, s string) error {
+	return WriteVarBytes(w, []byte(s))
+}
@@ -0,0 +1,144 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestVarInt checks the varint encoding against known
+// vectors at the boundaries of each form
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		value   uint64
+		encoded string
+	}{
+		{0, "00"},
+		{0xfc, "fc"},
+		{0xfd, "fdfd00"},
+		{0xffff, "fdffff"},
+		{0x10000, "fe00000100"},
+		{0xffffffff, "feffffffff"},
+		{0x100000000, "ff0000000001000000"},
+		{0xffffffffffffffff, "ffffffffffffffffff"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := WriteVarInt(&buf, test.value)
+		assert.NoError(t, err)
+		assert.Equal(t, test.encoded, hex.EncodeToString(buf.Bytes()))
+		assert.Equal(t, len(test.encoded)/2, VarIntSerializeSize(test.value))
+
+		value, err := ReadVarInt(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, test.value, value)
+	}
+}
+
+// TestVarIntNonCanonical checks values encoded in a
+// longer form than needed are rejected
+func TestVarIntNonCanonical(t *testing.T) {
+	tests := []string{
+		"fd0000",
+		"fdfc00",
+		"feffff0000",
+		"ffffffffff00000000",
+	}
+
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test)
+		_, err := ReadVarInt(bytes.NewReader(data))
+		assert.Error(t, err, test)
+	}
+}
+
+// TestVarBytesMaxAllowed checks lengths above the maximum
+// are rejected before reading the bytes
+func TestVarBytesMaxAllowed(t *testing.T) {
+	data, _ := hex.DecodeString("fe00000001")
+	_, err := ReadVarBytes(bytes.NewReader(data), 32, "test")
+	assert.Error(t, err)
+}
+
+// TestHash checks hashes are padded to 32 bytes and an
+// empty hash survives being encoded
+func TestHash(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteHash(&buf, []byte{}))
+	assert.Equal(t, HashSize, buf.Len())
+
+	hash, err := ReadHash(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{}, hash)
+
+	assert.Error(t, WriteHash(&buf, make([]byte, HashSize+1)))
+}
+
+// TestMessages checks every message against its known
+// encoding and that it decodes back to the same message
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		msg     Message
+		encoded string
+	}{
+		{
+			&MsgVersion{Version: 1, BestHeight: -1, Timestamp: 1557266400, AddrFrom: ":3000"},
+			"76657273696f6e0000000000" + "01000000" + "ffffffff" + "e0ffd15c00000000" + "053a33303030",
+		},
+		{
+			&MsgAddr{AddrList: []string{":3000", ":3001"}},
+			"616464720000000000000000" + "02" + "053a33303030" + "053a33303031",
+		},
+		{
+			&MsgGetBlocks{AddrFrom: ":3000"},
+			"676574626c6f636b73000000" + "053a33303030",
+		},
+		{
+			&MsgInv{AddrFrom: ":3000", Type: InvTypeBlock, Items: [][]byte{{0xaa, 0xbb}}},
+			"696e76000000000000000000" + "053a33303030" + "02000000" + "01" + "02aabb",
+		},
+		{
+			&MsgGetData{AddrFrom: ":3000", Type: InvTypeTx, ID: []byte{0xcc}},
+			"676574646174610000000000" + "053a33303030" + "01000000" + "01cc",
+		},
+		{
+			&MsgBlock{AddrFrom: ":3000", Block: []byte{0x01, 0x02}},
+			"626c6f636b00000000000000" + "053a33303030" + "020102",
+		},
+		{
+			&MsgTx{AddrFrom: ":3000", Transaction: []byte{0x03}},
+			"747800000000000000000000" + "053a33303030" + "0103",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		err := WriteMessage(&buf, test.msg, MainNet)
+		assert.NoError(t, err)
+		assert.Equal(t, "e1c0b4d9"+test.encoded, hex.EncodeToString(buf.Bytes()), test.msg.Command())
+
+		msg, err := ReadMessage(&buf, MainNet)
+		assert.NoError(t, err)
+		assert.Equal(t, test.msg, msg)
+	}
+}
+
+// TestUnknownCommand checks messages with an unknown command are rejected
+func TestUnknownCommand(t *testing.T) {
+	data, _ := hex.DecodeString("e1c0b4d9" + "6e6f7065000000000000000000")
+	_, err := ReadMessage(bytes.NewReader(data), MainNet)
+	assert.Error(t, err)
+}
+
+// TestWrongNet checks messages of another network are rejected
+func TestWrongNet(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMessage(&buf, &MsgGetBlocks{AddrFrom: ":3000"}, TestNet)
+	assert.NoError(t, err)
+
+	_, err = ReadMessage(&buf, MainNet)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+/*
+Package wire implements the binary encoding used by gophercoin both to
+store blocks and transactions and to relay them between peers.
+
+The encoding is deterministic: a value has exactly one valid encoding,
+so hashes computed over it, such as block hashes and transaction IDs,
+can be reproduced by any implementation following these rules.
+
+# Primitive types
+
+	uint32, int32   4 bytes, little endian, two's complement when signed
+	uint64, int64   8 bytes, little endian, two's complement when signed
+	hash            32 bytes, an empty hash is encoded as all zeroes
+	varint          1, 3, 5 or 9 bytes, see below
+	var bytes       varint length followed by the bytes
+	var string      varint length followed by the UTF-8 bytes
+
+A varint encodes an unsigned integer in the smallest of the following
+forms which can hold it. Any other form is rejected as non canonical.
+
+	value < 0xfd          1 byte:  the value itself
+	value <= 0xffff       3 bytes: 0xfd followed by a uint16
+	value <= 0xffffffff   5 bytes: 0xfe followed by a uint32
+	otherwise             9 bytes: 0xff followed by a uint64
+
+# Transactions
+
+A transaction input is encoded as:
+
+	var bytes   ID of the transaction which created the spent output
+	uint32      index of the spent output, 0xffffffff for a coinbase
+	var bytes   signature
+	var bytes   public key, or arbitrary data for a coinbase
+
+A transaction output is encoded as:
+
+	int64       value
+	var bytes   hash of the public key the output is locked to
+
+A transaction is encoded as:
+
+	var bytes   ID, empty when computing the hash which becomes the ID
+	varint      number of inputs, followed by the inputs
+	varint      number of outputs, followed by the outputs
+
+# Blocks
+
+A block header takes exactly 84 bytes:
+
+	int32       version
+	hash        previous block hash
+	hash        merkle root of the transactions
+	int64       timestamp, seconds since the unix epoch
+	uint32      difficulty bits in compact form
+	uint32      nonce
+
+The block hash is the SHA-256 of the encoded header. A block is encoded
+as its header, its height as a uint32 and a varint number of
+transactions followed by the transactions.
+
+# Messages
+
+Peers exchange messages made of the uint32 magic number of the network
+they belong to, a 12 byte command, the name of the message padded with
+zeroes, followed by the payload of the message. A message with the magic
+number of another network is rejected. See the Msg types for the payload
+of each command.
+*/
+package wire
@@ -0,0 +1,139 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// CommandSize is the size of the command at the start of every message
+const CommandSize = 12
+
+// Net identifies the network a message belongs to. It is written at
+// the start of every message so the nodes of different networks never
+// process each other's messages.
+type Net uint32
+
+// Networks gophercoin nodes can run on
+const (
+	MainNet Net = 0xd9b4c0e1
+	TestNet Net = 0x0709110b
+	RegTest Net = 0xdab5bffa
+)
+
+// netStrings maps the known networks to their name
+var netStrings = map[Net]string{
+	MainNet: "MainNet",
+	TestNet: "TestNet",
+	RegTest: "RegTest",
+}
+
+// String returns the name of the network
+func (n Net) String() string {
+	if s, ok := netStrings[n]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown Net (%d)", uint32(n))
+}
+
+// Commands of the messages exchanged between peers
+const (
+	CmdAddr      = "addr"
+	CmdBlock     = "block"
+	CmdGetBlocks = "getblocks"
+	CmdGetData   = "getdata"
+	CmdInv       = "inv"
+	CmdTx        = "tx"
+	CmdVersion   = "version"
+)
+
+// Message is a message exchanged between peers, which knows
+// how to encode and decode its own payload
+type Message interface {
+	Command() string
+	Encode(w io.Writer) error
+	Decode(r io.Reader) error
+}
+
+// makeEmptyMessage returns a message of the type given by
+// the command, ready to have its payload decoded into it
+func makeEmptyMessage(command string) (Message, error) {
+	var msg Message
+
+	switch command {
+	case CmdAddr:
+		msg = &MsgAddr{}
+	case CmdBlock:
+		msg = &MsgBlock{}
+	case CmdGetBlocks:
+		msg = &MsgGetBlocks{}
+	case CmdGetData:
+		msg = &MsgGetData{}
+	case CmdInv:
+		msg = &MsgInv{}
+	case CmdTx:
+		msg = &MsgTx{}
+	case CmdVersion:
+		msg = &MsgVersion{}
+	default:
+		return nil, messageError("makeEmptyMessage", fmt.Sprintf("unhandled command [%s]", command))
+	}
+
+	return msg, nil
+}
+
+// WriteMessage writes the network the message belongs to and its
+// command, padded with zeroes, followed by its payload
+func WriteMessage(w io.Writer, msg Message, net Net) error {
+	command := msg.Command()
+	if len(command) > CommandSize {
+		return messageError("WriteMessage", fmt.Sprintf("command [%s] is too long", command))
+	}
+
+	err := WriteUint32(w, uint32(net))
+	if err != nil {
+		return err
+	}
+
+	var cmd [CommandSize]byte
+	copy(cmd[:], command)
+	if _, err := w.Write(cmd[:]); err != nil {
+		return err
+	}
+
+	return msg.Encode(w)
+}
+
+// ReadMessage reads a message written by WriteMessage,
+// rejecting it when it belongs to another network
+func ReadMessage(r io.Reader, net Net) (Message, error) {
+	magic, err := ReadUint32(r)
+	if err != nil {
+		return nil, err
+	}
+	if Net(magic) != net {
+		return nil, messageError("ReadMessage", fmt.Sprintf("message from network %v, expected %v", Net(magic), net))
+	}
+
+	var cmd [CommandSize]byte
+	if _, err := io.ReadFull(r, cmd[:]); err != nil {
+		return nil, err
+	}
+
+	n := 0
+	for n < CommandSize && cmd[n] != 0 {
+		n++
+	}
+
+	msg, err := makeEmptyMessage(string(cmd[:n]))
+	if err != nil {
+		return nil, err
+	}
+
+	err = msg.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
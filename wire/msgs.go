@@ -0,0 +1,391 @@
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// MaxAddrLen is the maximum length of a peer address
+	MaxAddrLen = 256
+
+	// MaxAddrPerMsg is the maximum number of addresses in an addr message
+	MaxAddrPerMsg = 1000
+
+	// MaxInvPerMsg is the maximum number of items in an inv message
+	MaxInvPerMsg = 50000
+)
+
+// InvType identifies the kind of object an inventory item refers to
+type InvType uint32
+
+// These constants define the known inventory types
+const (
+	InvTypeTx    InvType = 1
+	InvTypeBlock InvType = 2
+)
+
+// String returns the InvType as a human-readable name
+func (t InvType) String() string {
+	switch t {
+	case InvTypeTx:
+		return "tx"
+	case InvTypeBlock:
+		return "block"
+	}
+
+	return fmt.Sprintf("Unknown InvType (%d)", uint32(t))
+}
+
+// MsgAddr shares the addresses of the peers a node knows
+//
+//	varint       number of addresses
+//	var string   address, repeated
+type MsgAddr struct {
+	AddrList []string
+}
+
+// Command returns the command of the message
+func (msg *MsgAddr) Command() string {
+	return CmdAddr
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgAddr) Encode(w io.Writer) error {
+	if len(msg.AddrList) > MaxAddrPerMsg {
+		return messageError("MsgAddr.Encode", fmt.Sprintf("too many addresses [count %d, max %d]", len(msg.AddrList), MaxAddrPerMsg))
+	}
+
+	err := WriteVarInt(w, uint64(len(msg.AddrList)))
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range msg.AddrList {
+		err = WriteVarString(w, addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgAddr) Decode(r io.Reader) error {
+	count, err := ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count > MaxAddrPerMsg {
+		return messageError("MsgAddr.Decode", fmt.Sprintf("too many addresses [count %d, max %d]", count, MaxAddrPerMsg))
+	}
+
+	msg.AddrList = make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		addr, err := ReadVarString(r, MaxAddrLen)
+		if err != nil {
+			return err
+		}
+		msg.AddrList = append(msg.AddrList, addr)
+	}
+
+	return nil
+}
+
+// MsgBlock relays a block
+//
+//	var string   address of the sender
+//	var bytes    encoded block
+type MsgBlock struct {
+	AddrFrom string
+	Block    []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgBlock) Command() string {
+	return CmdBlock
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgBlock) Encode(w io.Writer) error {
+	err := WriteVarString(w, msg.AddrFrom)
+	if err != nil {
+		return err
+	}
+
+	return WriteVarBytes(w, msg.Block)
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgBlock) Decode(r io.Reader) error {
+	var err error
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	if err != nil {
+		return err
+	}
+
+	msg.Block, err = ReadVarBytes(r, MaxVarBytesLen, "block")
+	return err
+}
+
+// MsgGetBlocks asks a peer for the inventory of its blocks
+//
+//	var string   address of the sender
+type MsgGetBlocks struct {
+	AddrFrom string
+}
+
+// Command returns the command of the message
+func (msg *MsgGetBlocks) Command() string {
+	return CmdGetBlocks
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgGetBlocks) Encode(w io.Writer) error {
+	return WriteVarString(w, msg.AddrFrom)
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgGetBlocks) Decode(r io.Reader) error {
+	var err error
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	return err
+}
+
+// MsgGetData asks a peer for a block or a transaction
+//
+//	var string   address of the sender
+//	uint32       inventory type
+//	var bytes    hash of the requested object
+type MsgGetData struct {
+	AddrFrom string
+	Type     InvType
+	ID       []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgGetData) Command() string {
+	return CmdGetData
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgGetData) Encode(w io.Writer) error {
+	err := WriteVarString(w, msg.AddrFrom)
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint32(w, uint32(msg.Type))
+	if err != nil {
+		return err
+	}
+
+	return WriteVarBytes(w, msg.ID)
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgGetData) Decode(r io.Reader) error {
+	var err error
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	if err != nil {
+		return err
+	}
+
+	invType, err := ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.Type = InvType(invType)
+
+	msg.ID, err = ReadVarBytes(r, HashSize, "id")
+	return err
+}
+
+// MsgInv announces blocks or transactions a node has
+//
+//	var string   address of the sender
+//	uint32       inventory type
+//	varint       number of items
+//	var bytes    hash of an item, repeated
+type MsgInv struct {
+	AddrFrom string
+	Type     InvType
+	Items    [][]byte
+}
+
+// Command returns the command of the message
+func (msg *MsgInv) Command() string {
+	return CmdInv
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgInv) Encode(w io.Writer) error {
+	if len(msg.Items) > MaxInvPerMsg {
+		return messageError("MsgInv.Encode", fmt.Sprintf("too many items [count %d, max %d]", len(msg.Items), MaxInvPerMsg))
+	}
+
+	err := WriteVarString(w, msg.AddrFrom)
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint32(w, uint32(msg.Type))
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, uint64(len(msg.Items)))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range msg.Items {
+		err = WriteVarBytes(w, item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgInv) Decode(r io.Reader) error {
+	var err error
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	if err != nil {
+		return err
+	}
+
+	invType, err := ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.Type = InvType(invType)
+
+	count, err := ReadVarInt(r)
+	if err != nil {
+		return err
+	}
+
+	if count > MaxInvPerMsg {
+		return messageError("MsgInv.Decode", fmt.Sprintf("too many items [count %d, max %d]", count, MaxInvPerMsg))
+	}
+
+	msg.Items = make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		item, err := ReadVarBytes(r, HashSize, "item")
+		if err != nil {
+			return err
+		}
+		msg.Items = append(msg.Items, item)
+	}
+
+	return nil
+}
+
+// MsgTx relays a transaction
+//
+//	var string   address of the sender
+//	var bytes    encoded transaction
+type MsgTx struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// Command returns the command of the message
+func (msg *MsgTx) Command() string {
+	return CmdTx
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgTx) Encode(w io.Writer) error {
+	err := WriteVarString(w, msg.AddrFrom)
+	if err != nil {
+		return err
+	}
+
+	return WriteVarBytes(w, msg.Transaction)
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgTx) Decode(r io.Reader) error {
+	var err error
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	if err != nil {
+		return err
+	}
+
+	msg.Transaction, err = ReadVarBytes(r, MaxVarBytesLen, "transaction")
+	return err
+}
+
+// MsgVersion is sent when connecting to a peer to compare the
+// height of both chains
+//
+//	int32        protocol version
+//	int32        best height, -1 when the node has no chain
+//	int64        current time of the sender, seconds since the unix epoch
+//	var string   address of the sender
+type MsgVersion struct {
+	Version    int32
+	BestHeight int32
+	Timestamp  int64
+	AddrFrom   string
+}
+
+// Command returns the command of the message
+func (msg *MsgVersion) Command() string {
+	return CmdVersion
+}
+
+// Encode writes the payload of the message to w
+func (msg *MsgVersion) Encode(w io.Writer) error {
+	err := WriteUint32(w, uint32(msg.Version))
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint32(w, uint32(msg.BestHeight))
+	if err != nil {
+		return err
+	}
+
+	err = WriteUint64(w, uint64(msg.Timestamp))
+	if err != nil {
+		return err
+	}
+
+	return WriteVarString(w, msg.AddrFrom)
+}
+
+// Decode reads the payload of the message from r
+func (msg *MsgVersion) Decode(r io.Reader) error {
+	version, err := ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.Version = int32(version)
+
+	bestHeight, err := ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.BestHeight = int32(bestHeight)
+
+	timestamp, err := ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	msg.Timestamp = int64(timestamp)
+
+	msg.AddrFrom, err = ReadVarString(r, MaxAddrLen)
+	return err
+}